@@ -0,0 +1,69 @@
+package display
+
+// lcdCharset maps the non-ASCII characters to the HD44780 A00 ROM codes.
+var lcdCharset = map[rune]byte{
+	'¥': 0x5C,
+	'→': 0x7E,
+	'←': 0x7F,
+	'°': 0xDF,
+	'α': 0xE0,
+	'ä': 0xE1,
+	'β': 0xE2,
+	'ß': 0xE2,
+	'ε': 0xE3,
+	'µ': 0xE4,
+	'μ': 0xE4,
+	'σ': 0xE5,
+	'ρ': 0xE6,
+	'√': 0xE8,
+	'¢': 0xEC,
+	'ñ': 0xEE,
+	'ö': 0xEF,
+	'θ': 0xF2,
+	'∞': 0xF3,
+	'Ω': 0xF4,
+	'ü': 0xF5,
+	'Σ': 0xF6,
+	'π': 0xF7,
+	'÷': 0xFD,
+	'█': 0xFF,
+}
+
+// lcdTransliterations maps the Latin-1 letters missing from the ROM to ASCII.
+var lcdTransliterations = map[rune]byte{
+	'À': 'A', 'Á': 'A', 'Â': 'A', 'Ã': 'A', 'Ä': 'A', 'Å': 'A',
+	'Ç': 'C',
+	'È': 'E', 'É': 'E', 'Ê': 'E', 'Ë': 'E',
+	'Ì': 'I', 'Í': 'I', 'Î': 'I', 'Ï': 'I',
+	'Ñ': 'N',
+	'Ò': 'O', 'Ó': 'O', 'Ô': 'O', 'Õ': 'O', 'Ö': 'O', 'Ø': 'O',
+	'Ù': 'U', 'Ú': 'U', 'Û': 'U', 'Ü': 'U',
+	'Ý': 'Y',
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'å': 'a',
+	'ç': 'c',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ø': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u',
+	'ý': 'y', 'ÿ': 'y',
+}
+
+// toLCD converts the text to the LCD character codes, one per column.
+// The custom characters, 0 to 7, and the printable ASCII characters are kept,
+// the other characters are mapped to the ROM or transliterated, or shown as '?'.
+func toLCD(text string) []byte {
+	res := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r < 8 || r >= ' ' && r < 0x7E && r != '\\':
+			res = append(res, byte(r))
+		case lcdCharset[r] != 0:
+			res = append(res, lcdCharset[r])
+		case lcdTransliterations[r] != 0:
+			res = append(res, lcdTransliterations[r])
+		default:
+			res = append(res, '?')
+		}
+	}
+	return res
+}
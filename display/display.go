@@ -1,26 +1,65 @@
 package display
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"gobot.io/x/gobot"
 	"gobot.io/x/gobot/drivers/i2c"
 )
 
+// The PCF8574 expander pins drive the LCD: P0 is RS, P1 is RW, P2 is EN,
+// P3 is the backlight and P4 to P7 are the D4 to D7 data lines.
+const (
+	pinRS        = 0x01
+	pinEN        = 0x04
+	pinBacklight = 0x08
+)
+
 const (
 	// command signals that we want to send a command to the screen
-	command = 0x04
+	command = pinEN
 
 	// data signals that we want to send a command to the screen
-	data = 0x05
+	data = pinEN | pinRS
 
 	// address is our default address
 	address = 0x27
 )
 
+// ErrOverflow is returned by DisplayWrapped when the message doesn't fit the display.
+var ErrOverflow = errors.New("message does not fit on the display")
+
+// Overflow selects how DisplayWrapped handles the messages longer than the display.
+type Overflow int
+
+const (
+	// OverflowReport shows the beginning of the message and returns ErrOverflow
+	OverflowReport Overflow = iota
+
+	// OverflowScroll scrolls the message up to show its end
+	OverflowScroll
+)
+
+// Alignment is the placement of a message within a line.
+type Alignment int
+
+const (
+	// AlignLeft pads the message on the right
+	AlignLeft Alignment = iota
+
+	// AlignCenter pads the message on both sides, with the extra space on the right
+	AlignCenter
+
+	// AlignRight pads the message on the left
+	AlignRight
+)
+
 // SunFounderLCD1602Driver controls the LCD 1602 from SunFounder
-//
-//goland:noinspection GoUnnecessarilyExportedIdentifiers
 type SunFounderLCD1602Driver struct {
 	name         string
 	i2cConnector i2c.Connector
@@ -31,6 +70,35 @@ type SunFounderLCD1602Driver struct {
 	conn    i2c.Connection
 
 	backlightEnabled bool
+
+	// cols and rows are the LCD dimensions
+	cols int
+	rows int
+
+	// overflow is how DisplayWrapped handles the long messages
+	overflow Overflow
+
+	// haltMessage is left on the display by Halt, instead of clearing it
+	haltMessage string
+
+	// ddram mirrors the display data RAM at the ddramAddr address counter,
+	// unless the data goes to the CGRAM after a custom character definition
+	ddram     [0x80]byte
+	ddramAddr int
+	cgram     bool
+
+	// progressDefined tells if the DisplayProgress glyphs are in the CGRAM
+	progressDefined bool
+
+	// mtx serializes the writes, including the backlight timeout ones
+	mtx sync.Mutex
+
+	// backlightTimeout turns off the backlight after inactivity, backlightGen
+	// identifies the last timer and backlightTimedOut tells if it expired
+	backlightTimeout  time.Duration
+	backlightTimer    *time.Timer
+	backlightGen      int
+	backlightTimedOut bool
 }
 
 // Name of our device
@@ -45,6 +113,9 @@ func (lcd *SunFounderLCD1602Driver) SetName(name string) {
 
 // Start the device work
 func (lcd *SunFounderLCD1602Driver) Start() error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
 	bus := lcd.GetBusOrDefault(lcd.i2cConnector.GetDefaultBus())
 
 	var err error
@@ -53,7 +124,13 @@ func (lcd *SunFounderLCD1602Driver) Start() error {
 		return err
 	}
 
-	commands := []byte{0x33, 0x32, 0x28, 0x0C}
+	// 4 bits mode, with 2 lines unless there is a single row
+	functionSet := byte(0x28)
+	if lcd.rows == 1 {
+		functionSet = 0x20
+	}
+
+	commands := []byte{0x33, 0x32, functionSet, 0x0C}
 	for _, cmd := range commands {
 		if err = lcd.sendCommand(cmd); err != nil {
 			return err
@@ -61,13 +138,23 @@ func (lcd *SunFounderLCD1602Driver) Start() error {
 		time.Sleep(5 * time.Millisecond)
 	}
 
-	return lcd.ClearScreen()
+	return lcd.clearScreen()
 }
 
 // Halt stops the device in a graceful way
 func (lcd *SunFounderLCD1602Driver) Halt() error {
-	lcd.backlightEnabled = false
-	return lcd.ClearScreen()
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	lcd.stopBacklightTimer()
+	if lcd.haltMessage != "" {
+		return lcd.displayMessage(lcd.haltMessage)
+	}
+
+	if err := lcd.disableBacklight(); err != nil {
+		return err
+	}
+	return lcd.clearScreen()
 }
 
 // Connection retrieves the i2c connection to the device
@@ -77,21 +164,101 @@ func (lcd *SunFounderLCD1602Driver) Connection() gobot.Connection {
 
 // Send a command to the LCD
 func (lcd *SunFounderLCD1602Driver) sendCommand(cmd byte) (err error) {
-	return lcd.communicate(command, cmd)
+	if err = lcd.communicate(command, cmd); err != nil {
+		return err
+	}
+
+	switch {
+	case cmd&0x80 != 0:
+		lcd.ddramAddr = int(cmd & 0x7F)
+		lcd.cgram = false
+	case cmd&0x40 != 0:
+		lcd.cgram = true
+	case cmd == 0x01:
+		lcd.clearShadow()
+		lcd.ddramAddr = 0
+		lcd.cgram = false
+	case cmd&0xFE == 0x02:
+		lcd.ddramAddr = 0
+		lcd.cgram = false
+	case cmd&0xF8 == 0x10 && !lcd.cgram:
+		// the cursor shift moves the address counter, the display shift doesn't
+		lcd.stepAddr(cmd&0x04 != 0)
+	}
+	return nil
 }
 
 // Send data to the LCD
 func (lcd *SunFounderLCD1602Driver) sendData(cmd byte) (err error) {
-	return lcd.communicate(data, cmd)
+	if err = lcd.communicate(data, cmd); err != nil {
+		return err
+	}
+
+	if lcd.cgram {
+		return nil
+	}
+
+	lcd.ddram[lcd.ddramAddr] = cmd
+	lcd.stepAddr(true)
+	return nil
+}
+
+// stepAddr moves the DDRAM address counter by one cell to the right or to the left.
+// It wraps like the LCD one, from the end of a line to the next.
+func (lcd *SunFounderLCD1602Driver) stepAddr(right bool) {
+	if right {
+		lcd.ddramAddr++
+		switch {
+		case lcd.rows == 1 && lcd.ddramAddr == 0x50:
+			lcd.ddramAddr = 0
+		case lcd.rows > 1 && lcd.ddramAddr == 0x28:
+			lcd.ddramAddr = 0x40
+		case lcd.ddramAddr == 0x68:
+			lcd.ddramAddr = 0
+		}
+		return
+	}
+
+	switch {
+	case lcd.rows == 1 && lcd.ddramAddr == 0:
+		lcd.ddramAddr = 0x4F
+	case lcd.rows > 1 && lcd.ddramAddr == 0x40:
+		lcd.ddramAddr = 0x27
+	case lcd.ddramAddr == 0:
+		lcd.ddramAddr = 0x67
+	default:
+		lcd.ddramAddr--
+	}
+}
+
+// clearShadow fills the DDRAM mirror with spaces, like the clear display command.
+func (lcd *SunFounderLCD1602Driver) clearShadow() {
+	for i := range lcd.ddram {
+		lcd.ddram[i] = ' '
+	}
+}
+
+// Contents returns the characters shown on each row of the display, as
+// written to the LCD: the custom characters and the ROM codes are not
+// converted back to UTF-8.
+func (lcd *SunFounderLCD1602Driver) Contents() []string {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	res := make([]string, lcd.rows)
+	for row := range res {
+		start := lcd.rowAddress(row)
+		res[row] = string(lcd.ddram[start : start+lcd.cols])
+	}
+	return res
 }
 
 // write handles the actual data writing to the LCD i2c connection
 func (lcd *SunFounderLCD1602Driver) write(data byte) error {
-	temp := data
+	// The backlight pin keeps its state during the commands and data
+	temp := data &^ pinBacklight
 	if lcd.backlightEnabled {
-		temp |= 0x08
-	} else {
-		temp |= 0x07
+		temp |= pinBacklight
 	}
 
 	return lcd.conn.WriteByte(temp)
@@ -108,7 +275,7 @@ func (lcd *SunFounderLCD1602Driver) communicate(cmdType byte, cmd byte) error {
 
 	time.Sleep(2 * time.Millisecond)
 
-	buf &= 0xFB // Make EN = 0
+	buf &^= pinEN // Make EN = 0
 	if err := lcd.write(buf); err != nil {
 		return err
 	}
@@ -121,124 +288,745 @@ func (lcd *SunFounderLCD1602Driver) communicate(cmdType byte, cmd byte) error {
 	}
 
 	time.Sleep(2 * time.Millisecond)
-	buf &= 0xFB // Make EN = 0
+	buf &^= pinEN // Make EN = 0
 	return lcd.write(buf)
 }
 
 // EnableBacklight turns on the screen backlight
 func (lcd *SunFounderLCD1602Driver) EnableBacklight() error {
-	err := lcd.write(0x08)
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+	return lcd.enableBacklight()
+}
+
+func (lcd *SunFounderLCD1602Driver) enableBacklight() error {
+	lcd.backlightEnabled = true
+	err := lcd.write(0x00)
 	time.Sleep(2 * time.Millisecond)
 	return err
 }
 
 // DisableBacklight turns off the screen backlight
 func (lcd *SunFounderLCD1602Driver) DisableBacklight() error {
-	err := lcd.write(0x07)
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+	return lcd.disableBacklight()
+}
+
+func (lcd *SunFounderLCD1602Driver) disableBacklight() error {
+	lcd.backlightEnabled = false
+	err := lcd.write(0x00)
 	time.Sleep(2 * time.Millisecond)
 	return err
 }
 
 // ClearScreen removes any message from the LCD screen
 func (lcd *SunFounderLCD1602Driver) ClearScreen() error {
-	// The screen clearing commands needs to be
-	// sent with the backlight turned on
-	tmp := lcd.backlightEnabled
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+	return lcd.clearScreen()
+}
+
+func (lcd *SunFounderLCD1602Driver) clearScreen() error {
+	err := lcd.sendCommand(0x01)
+	time.Sleep(2 * time.Millisecond)
+	return err
+}
+
+// SetBacklightTimeout turns off the backlight after the given time without
+// DisplayMessage or DisplayMessageWithCoordinates calls. The next of those calls
+// turns the backlight on again. A zero duration disables the timeout and
+// turns the backlight on again if it expired.
+func (lcd *SunFounderLCD1602Driver) SetBacklightTimeout(d time.Duration) error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	lcd.backlightTimeout = d
+	lcd.stopBacklightTimer()
+	if d > 0 {
+		lcd.startBacklightTimer()
+		return nil
+	}
+
+	if !lcd.backlightTimedOut {
+		return nil
+	}
+	lcd.backlightTimedOut = false
 	lcd.backlightEnabled = true
-	if err := lcd.sendCommand(0x01); err != nil {
-		return err
+	return lcd.enableBacklight()
+}
+
+// Restarts the backlight timeout, turning the backlight on again if it expired.
+func (lcd *SunFounderLCD1602Driver) touchBacklight() error {
+	if lcd.backlightTimeout <= 0 {
+		return nil
 	}
 
-	time.Sleep(2 * time.Millisecond)
+	lcd.stopBacklightTimer()
+	lcd.startBacklightTimer()
 
-	lcd.backlightEnabled = tmp
+	if !lcd.backlightTimedOut {
+		return nil
+	}
+	lcd.backlightTimedOut = false
+	lcd.backlightEnabled = true
+	return lcd.enableBacklight()
+}
 
-	if lcd.backlightEnabled {
-		return lcd.EnableBacklight()
+func (lcd *SunFounderLCD1602Driver) startBacklightTimer() {
+	lcd.backlightGen++
+	gen := lcd.backlightGen
+	lcd.backlightTimer = time.AfterFunc(lcd.backlightTimeout, func() {
+		lcd.mtx.Lock()
+		defer lcd.mtx.Unlock()
+
+		// a newer timer replaced this one
+		if gen != lcd.backlightGen || !lcd.backlightEnabled {
+			return
+		}
+		lcd.backlightTimedOut = true
+		lcd.backlightEnabled = false
+		_ = lcd.disableBacklight()
+	})
+}
+
+func (lcd *SunFounderLCD1602Driver) stopBacklightTimer() {
+	if lcd.backlightTimer != nil {
+		lcd.backlightTimer.Stop()
+		lcd.backlightTimer = nil
+	}
+	lcd.backlightGen++
+}
+
+// SetCursor shows or hides the cursor, and makes it blink or not.
+// The display stays on.
+func (lcd *SunFounderLCD1602Driver) SetCursor(visible, blink bool) error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	cmd := byte(0x08 | 0x04) // display control, display on
+	if visible {
+		cmd |= 0x02
+	}
+	if blink {
+		cmd |= 0x01
+	}
+	return lcd.sendCommand(cmd)
+}
+
+// ShiftDisplay moves the whole display content by one column
+// to the left or to the right, without changing it.
+func (lcd *SunFounderLCD1602Driver) ShiftDisplay(left bool) error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+	return lcd.sendCommand(shiftCommand(0x08, left))
+}
+
+// ShiftCursor moves the cursor by one column to the left or to the right.
+func (lcd *SunFounderLCD1602Driver) ShiftCursor(left bool) error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+	return lcd.sendCommand(shiftCommand(0x00, left))
+}
+
+// shiftCommand builds the cursor or display shift command.
+func shiftCommand(target byte, left bool) byte {
+	cmd := 0x10 | target
+	if !left {
+		cmd |= 0x04
+	}
+	return cmd
+}
+
+// DefineCustomChar stores a 5x8 glyph in one of the 8 CGRAM slots.
+// Each byte of the pattern is a row, from the top, using its 5 low bits.
+// The glyph is printed by its slot code, e.g. "\x01" for slot 1.
+func (lcd *SunFounderLCD1602Driver) DefineCustomChar(slot int, pattern [8]byte) error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	if slot < progressGlyphs {
+		lcd.progressDefined = false
+	}
+	return lcd.defineCustomChar(slot, pattern)
+}
+
+func (lcd *SunFounderLCD1602Driver) defineCustomChar(slot int, pattern [8]byte) error {
+	if slot < 0 || slot > 7 {
+		return fmt.Errorf("custom character slot %d not in 0 ... 7 bounds", slot)
+	}
+
+	// Set CGRAM address
+	if err := lcd.sendCommand(byte(0x40 | slot<<3)); err != nil {
+		return err
+	}
+
+	for _, row := range pattern {
+		if err := lcd.sendData(row & 0x1F); err != nil {
+			return err
+		}
 	}
-	return lcd.DisableBacklight()
+	return nil
 }
 
-// DisplayMessageWithCoordinates renders our message on the display
+// DisplayMessageWithCoordinates renders our message on the display.
+// See DisplayMessage for the supported characters.
 func (lcd *SunFounderLCD1602Driver) DisplayMessageWithCoordinates(x, y int, msg string) error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	if err := lcd.touchBacklight(); err != nil {
+		return err
+	}
+
+	if err := lcd.moveCursor(x, y); err != nil {
+		return err
+	}
+
+	for _, ch := range toLCD(msg) {
+		if err := lcd.sendData(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCharAt renders a single character on the display, e.g. for a spinner.
+// See DisplayMessage for the supported characters.
+func (lcd *SunFounderLCD1602Driver) WriteCharAt(x, y int, ch rune) error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	if err := lcd.touchBacklight(); err != nil {
+		return err
+	}
+
+	if err := lcd.moveCursor(x, y); err != nil {
+		return err
+	}
+	return lcd.sendData(toLCD(string(ch))[0])
+}
+
+// moveCursor sets the DDRAM address to the position, clamped to the display.
+func (lcd *SunFounderLCD1602Driver) moveCursor(x, y int) error {
+	return lcd.sendCommand(byte(0x80 + lcd.cellAddress(x, y)))
+}
+
+// cellAddress is the DDRAM address of the position, clamped to the display.
+func (lcd *SunFounderLCD1602Driver) cellAddress(x, y int) int {
 	if x < 0 {
 		x = 0
 	}
 
-	if x > 15 {
-		x = 15
+	if x > lcd.cols-1 {
+		x = lcd.cols - 1
 	}
 
 	if y < 0 {
 		y = 0
 	}
 
-	if y > 1 {
-		y = 1
+	if y > lcd.rows-1 {
+		y = lcd.rows - 1
+	}
+
+	return lcd.rowAddress(y) + x
+}
+
+const (
+	// spinnerInterval is the time each StartSpinner glyph is shown
+	spinnerInterval = 150 * time.Millisecond
+
+	// spinnerBackslash is the custom character slot of the backslash,
+	// missing from the LCD ROM
+	spinnerBackslash = 7
+)
+
+// spinnerGlyphs are the StartSpinner frames.
+var spinnerGlyphs = []byte{'|', '/', '-', spinnerBackslash}
+
+// StartSpinner rotates a spinner in the cell, clamped to the display, until
+// the returned stop function is called. Stopping restores the previous
+// character of the cell. The spinner uses the custom character 7,
+// replacing its definition.
+func (lcd *SunFounderLCD1602Driver) StartSpinner(x, y int) (stop func()) {
+	lcd.mtx.Lock()
+	addr := lcd.cellAddress(x, y)
+	previous := lcd.ddram[addr]
+	_ = lcd.touchBacklight()
+	_ = lcd.defineCustomChar(spinnerBackslash, [8]byte{0x00, 0x10, 0x08, 0x04, 0x02, 0x01, 0x00, 0x00})
+	lcd.mtx.Unlock()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+
+		for frame := 0; ; frame = (frame + 1) % len(spinnerGlyphs) {
+			lcd.writeCell(addr, spinnerGlyphs[frame])
+
+			select {
+			case <-done:
+				lcd.writeCell(addr, previous)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+// writeCell writes the character at the DDRAM address. The errors are
+// dropped as there is nobody to report them to.
+func (lcd *SunFounderLCD1602Driver) writeCell(addr int, ch byte) {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	if err := lcd.sendCommand(byte(0x80 + addr)); err != nil {
+		return
 	}
+	_ = lcd.sendData(ch)
+}
 
-	// Move cursor
-	addr := byte(0x80 + 0x40*y + x)
-	if err := lcd.sendCommand(addr); err != nil {
+// DisplayMessage renders our message on the display, filling the rows in turn.
+// The message is UTF-8: the accented letters are shown using the LCD ROM
+// when available, e.g. 'ä' or '°', or without their accent otherwise.
+// The custom characters are shown by their slot code, "\x00" to "\x07".
+func (lcd *SunFounderLCD1602Driver) DisplayMessage(text string) error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	if err := lcd.touchBacklight(); err != nil {
 		return err
 	}
 
-	for _, ch := range msg {
-		if err := lcd.sendData(byte(ch)); err != nil {
+	return lcd.displayMessage(text)
+}
+
+func (lcd *SunFounderLCD1602Driver) displayMessage(text string) error {
+	msg := toLCD(text)
+
+	// Pad the message
+	for len(msg) < lcd.cols*lcd.rows {
+		msg = append(msg, ' ')
+	}
+
+	for row := 0; row < lcd.rows; row++ {
+		if err := lcd.displayLine(row, msg[row*lcd.cols:(row+1)*lcd.cols]); err != nil {
 			return err
 		}
 	}
+
 	return nil
 }
 
-// DisplayMessage renders our message on the display
-func (lcd *SunFounderLCD1602Driver) DisplayMessage(msg string) error {
-	// Pad the message
-	if len(msg) < 32 {
-		iLen := 32 - len(msg)
-		for i := 0; i < iLen; i++ {
-			msg += " "
+// DisplayWrapped renders our message on the display, wrapping the words
+// that don't fit on a row to the next one. The words longer than a row
+// are split. See WithOverflow for the messages longer than the display.
+func (lcd *SunFounderLCD1602Driver) DisplayWrapped(text string) error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	if err := lcd.touchBacklight(); err != nil {
+		return err
+	}
+
+	lines := wrapText(toLCD(text), lcd.cols)
+	overflow := len(lines) > lcd.rows
+	if overflow && lcd.overflow == OverflowScroll {
+		lines = lines[len(lines)-lcd.rows:]
+	}
+
+	for row := 0; row < lcd.rows; row++ {
+		line := make([]byte, 0, lcd.cols)
+		if row < len(lines) {
+			line = append(line, lines[row]...)
+		}
+		for len(line) < lcd.cols {
+			line = append(line, ' ')
+		}
+		if err := lcd.displayLine(row, line); err != nil {
+			return err
+		}
+	}
+
+	if overflow && lcd.overflow == OverflowReport {
+		return ErrOverflow
+	}
+	return nil
+}
+
+// wrapText splits the text into lines of up to cols characters, on the spaces
+// when possible.
+func wrapText(text []byte, cols int) [][]byte {
+	var lines [][]byte
+	var line []byte
+	for _, word := range bytes.Fields(text) {
+		if len(line) > 0 && len(line)+1+len(word) <= cols {
+			line = append(line, ' ')
+			line = append(line, word...)
+			continue
+		}
+
+		if len(line) > 0 {
+			lines = append(lines, line)
+			line = nil
 		}
+		for len(word) > cols {
+			lines = append(lines, word[:cols])
+			word = word[cols:]
+		}
+		line = append(line, word...)
+	}
+
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// DisplayAligned renders our message on the line, padded according to the alignment.
+// The messages longer than the line are truncated.
+func (lcd *SunFounderLCD1602Driver) DisplayAligned(line int, msg string, align Alignment) error {
+	if line < 0 || line > lcd.rows-1 {
+		return fmt.Errorf("line %d not in 0 ... %d bounds", line, lcd.rows-1)
+	}
+
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	if err := lcd.touchBacklight(); err != nil {
+		return err
+	}
+
+	return lcd.displayLine(line, alignText(toLCD(msg), lcd.cols, align))
+}
+
+// Update renders our message on the line, padded with spaces, writing only
+// the cells that differ from the current contents to avoid flickering.
+// The messages longer than the line are truncated.
+func (lcd *SunFounderLCD1602Driver) Update(line int, msg string) error {
+	if line < 0 || line > lcd.rows-1 {
+		return fmt.Errorf("line %d not in 0 ... %d bounds", line, lcd.rows-1)
+	}
+
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	if err := lcd.touchBacklight(); err != nil {
+		return err
+	}
+
+	start := lcd.rowAddress(line)
+	// The address counter is unknown after the CGRAM writes
+	addr := -1
+	if !lcd.cgram {
+		addr = lcd.ddramAddr
+	}
+	for col, ch := range alignText(toLCD(msg), lcd.cols, AlignLeft) {
+		if lcd.ddram[start+col] == ch {
+			continue
+		}
+
+		// Consecutive cells don't need moving the cursor
+		if addr != start+col {
+			if err := lcd.sendCommand(byte(0x80 + start + col)); err != nil {
+				return err
+			}
+		}
+		if err := lcd.sendData(ch); err != nil {
+			return err
+		}
+		addr = lcd.ddramAddr
+	}
+	return nil
+}
+
+// alignText pads or truncates the text to cols characters.
+func alignText(text []byte, cols int, align Alignment) []byte {
+	if len(text) > cols {
+		text = text[:cols]
+	}
+
+	left := 0
+	switch align {
+	case AlignCenter:
+		left = (cols - len(text)) / 2
+	case AlignRight:
+		left = cols - len(text)
+	}
+
+	res := bytes.Repeat([]byte{' '}, cols)
+	copy(res[left:], text)
+	return res
+}
+
+// progressGlyphs is the number of custom characters used by DisplayProgress,
+// for the cells with 1 to 4 of their 5 columns filled.
+const progressGlyphs = 4
+
+// DisplayProgress renders a bar filling the fraction of the line, clamped
+// to 0 ... 1, with a resolution of a fifth of a cell.
+// The bar uses the custom characters 0 to 3, replacing their definitions.
+func (lcd *SunFounderLCD1602Driver) DisplayProgress(line int, fraction float64) error {
+	if line < 0 || line > lcd.rows-1 {
+		return fmt.Errorf("line %d not in 0 ... %d bounds", line, lcd.rows-1)
 	}
 
-	addr := byte(0x80)
-	if err := lcd.sendCommand(addr); err != nil {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+
+	if err := lcd.touchBacklight(); err != nil {
 		return err
 	}
 
-	for _, ch := range msg[:16] {
-		if err := lcd.sendData(byte(ch)); err != nil {
+	if !lcd.progressDefined {
+		for slot := 0; slot < progressGlyphs; slot++ {
+			// The columns fill from the left, the highest bit
+			row := byte(0x1F &^ (0x1F >> uint(slot+1)))
+			glyph := [8]byte{row, row, row, row, row, row, row, row}
+			if err := lcd.defineCustomChar(slot, glyph); err != nil {
+				return err
+			}
+		}
+		lcd.progressDefined = true
+	}
+
+	return lcd.displayLine(line, progressCells(fraction, lcd.cols))
+}
+
+// progressCells returns the characters of a bar filling the fraction of cols cells.
+func progressCells(fraction float64, cols int) []byte {
+	if fraction < 0 || math.IsNaN(fraction) {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	filled := int(math.Round(fraction * float64(cols*5)))
+	cells := bytes.Repeat([]byte{' '}, cols)
+	for i := range cells {
+		switch columns := filled - i*5; {
+		case columns >= 5:
+			// The full block of the LCD ROM
+			cells[i] = 0xFF
+		case columns > 0:
+			cells[i] = byte(columns - 1)
+		}
+	}
+	return cells
+}
+
+// scrollGap is the spacing between the repeats of a scrolled message.
+const scrollGap = "    "
+
+// ScrollMessage scrolls the message from right to left on the line, moving
+// one column each interval, until the done channel is closed.
+// Messages fitting on the line are shown without scrolling.
+func (lcd *SunFounderLCD1602Driver) ScrollMessage(line int, msg string, interval time.Duration, done <-chan struct{}) error {
+	if line < 0 || line > lcd.rows-1 {
+		return fmt.Errorf("line %d not in 0 ... %d bounds", line, lcd.rows-1)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("scroll interval %v must be positive", interval)
+	}
+
+	text := toLCD(msg)
+	if len(text) <= lcd.cols {
+		if err := lcd.scrollLine(line, scrollFrame(text, 0, lcd.cols)); err != nil {
 			return err
 		}
+		<-done
+		return nil
 	}
+	text = append(text, scrollGap...)
 
-	addr = byte(0x80 + 0x40)
-	if err := lcd.sendCommand(addr); err != nil {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for offset := 0; ; offset = (offset + 1) % len(text) {
+		if err := lcd.scrollLine(line, scrollFrame(text, offset, lcd.cols)); err != nil {
+			return err
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// scrollFrame returns the columns of the text visible at the
+// offset, wrapping around the end of the text.
+func scrollFrame(text []byte, offset, cols int) []byte {
+	frame := make([]byte, cols)
+	for i := range frame {
+		if len(text) <= cols {
+			frame[i] = ' '
+			if i < len(text) {
+				frame[i] = text[i]
+			}
+			continue
+		}
+		frame[i] = text[(offset+i)%len(text)]
+	}
+	return frame
+}
+
+// BlinkMessage shows the message on the line and clears it, the given number
+// of times, each of them interval long, then restores the previous contents of
+// the line. Closing the done channel stops the blinking early.
+func (lcd *SunFounderLCD1602Driver) BlinkMessage(line int, msg string, times int, interval time.Duration, done <-chan struct{}) error {
+	if line < 0 || line > lcd.rows-1 {
+		return fmt.Errorf("line %d not in 0 ... %d bounds", line, lcd.rows-1)
+	}
+	if times < 1 {
+		return fmt.Errorf("blink times %d must be positive", times)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("blink interval %v must be positive", interval)
+	}
+
+	lcd.mtx.Lock()
+	if err := lcd.touchBacklight(); err != nil {
+		lcd.mtx.Unlock()
 		return err
 	}
+	start := lcd.rowAddress(line)
+	previous := append([]byte(nil), lcd.ddram[start:start+lcd.cols]...)
+	lcd.mtx.Unlock()
+
+	frames := [][]byte{
+		alignText(toLCD(msg), lcd.cols, AlignLeft),
+		bytes.Repeat([]byte{' '}, lcd.cols),
+	}
 
-	for _, ch := range msg[16:32] {
-		if err := lcd.sendData(byte(ch)); err != nil {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+blink:
+	for i := 0; i < 2*times; i++ {
+		if err := lcd.scrollLine(line, frames[i%2]); err != nil {
 			return err
 		}
+
+		select {
+		case <-done:
+			break blink
+		case <-ticker.C:
+		}
+	}
+
+	return lcd.scrollLine(line, previous)
+}
+
+// scrollLine writes an animation frame on the line.
+func (lcd *SunFounderLCD1602Driver) scrollLine(line int, chars []byte) error {
+	lcd.mtx.Lock()
+	defer lcd.mtx.Unlock()
+	return lcd.displayLine(line, chars)
+}
+
+// displayLine writes the characters from the start of the line.
+func (lcd *SunFounderLCD1602Driver) displayLine(line int, chars []byte) error {
+	if err := lcd.sendCommand(byte(0x80 + lcd.rowAddress(line))); err != nil {
+		return err
 	}
 
+	for _, ch := range chars {
+		if err := lcd.sendData(ch); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// rowAddress is the DDRAM address of the start of the row.
+// The third and fourth rows continue the first and second ones.
+func (lcd *SunFounderLCD1602Driver) rowAddress(row int) int {
+	return [...]int{0x00, 0x40, lcd.cols, 0x40 + lcd.cols}[row]
+}
+
+// WithDimensions sets the number of columns and rows of the LCD,
+// e.g. 20 and 4 for a 2004 module. The default is 16 columns and 2 rows.
+func WithDimensions(cols, rows int) func(i2c.Config) {
+	return func(c i2c.Config) {
+		if lcd, ok := c.(*SunFounderLCD1602Driver); ok {
+			lcd.cols = cols
+			lcd.rows = rows
+		}
+	}
+}
+
+// WithOverflow selects how DisplayWrapped handles the messages longer than the display.
+// The default is OverflowReport.
+func WithOverflow(overflow Overflow) func(i2c.Config) {
+	return func(c i2c.Config) {
+		if lcd, ok := c.(*SunFounderLCD1602Driver); ok {
+			lcd.overflow = overflow
+		}
+	}
+}
+
+// WithName sets the name identifying the display in the gobot logs and API.
+// An empty name keeps the default, "SunFounderLCD1602Driver-" and a random suffix.
+func WithName(name string) func(i2c.Config) {
+	return func(c i2c.Config) {
+		if lcd, ok := c.(*SunFounderLCD1602Driver); ok && name != "" {
+			lcd.name = name
+		}
+	}
+}
+
+// WithHaltMessage sets a message, e.g. "Shutting down", left on the
+// display by Halt instead of turning it off.
+func WithHaltMessage(msg string) func(i2c.Config) {
+	return func(c i2c.Config) {
+		if lcd, ok := c.(*SunFounderLCD1602Driver); ok {
+			lcd.haltMessage = msg
+		}
+	}
+}
+
 // NewLCD1602Driver creates a new GoBot driver for our FM transmitter
+// The LCD is at the 0x27 address unless set with i2c.WithAddress,
+// e.g. to 0x3F for the PCF8574A backpacks.
 func NewLCD1602Driver(connector i2c.Connector, options ...func(i2c.Config)) (*SunFounderLCD1602Driver, error) {
 	lcd := &SunFounderLCD1602Driver{
 		name:             gobot.DefaultName("SunFounderLCD1602Driver"),
 		i2cConnector:     connector,
 		Config:           i2c.NewConfig(),
-		i2cAddr:          address,
 		backlightEnabled: true,
+		cols:             16,
+		rows:             2,
 	}
+	lcd.clearShadow()
 
 	for _, option := range options {
 		option(lcd)
 	}
 
+	lcd.i2cAddr = lcd.GetAddressOrDefault(address)
+	if lcd.i2cAddr < 0x08 || lcd.i2cAddr > 0x77 {
+		return nil, fmt.Errorf("i2c address 0x%02x not in 0x08 ... 0x77 bounds", lcd.i2cAddr)
+	}
+
+	if lcd.rows < 1 || lcd.rows > 4 {
+		return nil, fmt.Errorf("LCD rows %d not in 1 ... 4 bounds", lcd.rows)
+	}
+	if lcd.cols < 1 || lcd.cols > 40 || lcd.rows > 2 && lcd.cols > 20 {
+		return nil, fmt.Errorf("LCD columns %d not in 1 ... 40 bounds, or 20 with 4 rows", lcd.cols)
+	}
+
 	return lcd, nil
 }
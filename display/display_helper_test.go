@@ -0,0 +1,128 @@
+package display
+
+import (
+	"sync"
+	"testing"
+
+	"gobot.io/x/gobot/drivers/i2c"
+)
+
+// lcdTestConnection records the bytes written to the PCF8574 expander
+// of the LCD and decodes them back to commands and data.
+type lcdTestConnection struct {
+	mtx     sync.Mutex
+	address int
+	written []byte
+}
+
+// lcdTransfer is a byte sent to the LCD, as a command or as data.
+type lcdTransfer struct {
+	data  bool
+	value byte
+}
+
+func (c *lcdTestConnection) GetConnection(address, _ int) (i2c.Connection, error) {
+	c.address = address
+	return c, nil
+}
+
+func (c *lcdTestConnection) GetDefaultBus() int {
+	return 0
+}
+
+func (c *lcdTestConnection) Read(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (c *lcdTestConnection) Write(b []byte) (int, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.written = append(c.written, b...)
+	return len(b), nil
+}
+
+func (c *lcdTestConnection) Close() error {
+	return nil
+}
+
+func (c *lcdTestConnection) ReadByte() (byte, error) {
+	return 0, nil
+}
+
+func (c *lcdTestConnection) ReadByteData(uint8) (uint8, error) {
+	return 0, nil
+}
+
+func (c *lcdTestConnection) ReadWordData(uint8) (uint16, error) {
+	return 0, nil
+}
+
+func (c *lcdTestConnection) WriteByte(val byte) error {
+	_, err := c.Write([]byte{val})
+	return err
+}
+
+func (c *lcdTestConnection) WriteByteData(reg uint8, val uint8) error {
+	_, err := c.Write([]byte{reg, val})
+	return err
+}
+
+func (c *lcdTestConnection) WriteWordData(reg uint8, val uint16) error {
+	_, err := c.Write([]byte{reg, uint8(val), uint8(val >> 8)})
+	return err
+}
+
+func (c *lcdTestConnection) WriteBlockData(reg uint8, b []byte) error {
+	_, err := c.Write(append([]byte{reg}, b...))
+	return err
+}
+
+// transfers decodes the written bytes into the commands and data sent to the LCD.
+// A nibble is latched on the falling edge of EN (P2), and two nibbles make a byte.
+func (c *lcdTestConnection) transfers() []lcdTransfer {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var res []lcdTransfer
+	var nibbles []byte
+	for i := 0; i+1 < len(c.written); i++ {
+		w := c.written[i]
+		if w&0x04 == 0 || c.written[i+1] != w&^0x04 {
+			continue
+		}
+
+		nibbles = append(nibbles, w)
+		if len(nibbles) == 2 {
+			res = append(res, lcdTransfer{
+				data:  nibbles[0]&0x01 != 0,
+				value: nibbles[0]&0xF0 | nibbles[1]>>4,
+			})
+			nibbles = nil
+		}
+		i++
+	}
+	return res
+}
+
+// reset forgets the bytes written so far.
+func (c *lcdTestConnection) reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.written = nil
+}
+
+// newTestLCD returns a started driver writing to a test connection.
+func newTestLCD(t *testing.T, options ...func(i2c.Config)) (*SunFounderLCD1602Driver, *lcdTestConnection) {
+	t.Helper()
+
+	conn := &lcdTestConnection{}
+	lcd, err := NewLCD1602Driver(conn, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lcd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	conn.reset()
+	return lcd, conn
+}
@@ -0,0 +1,875 @@
+package display
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gobot.io/x/gobot/drivers/i2c"
+)
+
+func TestDefineCustomChar(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+
+	degree := [8]byte{0x06, 0x09, 0x09, 0x06, 0x00, 0x00, 0x00, 0xFF}
+	if err := lcd.DefineCustomChar(2, degree); err != nil {
+		t.Fatal(err)
+	}
+
+	got := conn.transfers()
+	if len(got) != 9 {
+		t.Fatalf("got %d transfers, want 9: %v", len(got), got)
+	}
+	if got[0] != (lcdTransfer{data: false, value: 0x50}) {
+		t.Errorf("got %+v, want the CGRAM address 0x50 command", got[0])
+	}
+	for i, row := range degree {
+		want := lcdTransfer{data: true, value: row & 0x1F}
+		if got[i+1] != want {
+			t.Errorf("got row %d as %+v, want %+v", i, got[i+1], want)
+		}
+	}
+
+	for _, slot := range []int{-1, 8} {
+		if err := lcd.DefineCustomChar(slot, degree); err == nil {
+			t.Errorf("expected an error for slot %d", slot)
+		}
+	}
+}
+
+func TestDisplayCustomChar(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+
+	if err := lcd.DisplayMessageWithCoordinates(0, 0, "\x02C"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []lcdTransfer{{value: 0x80}, {data: true, value: 0x02}, {data: true, value: 'C'}}
+	got := conn.transfers()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %+v, want %+v", got[i], want[i])
+		}
+	}
+}
+
+func TestToLCD(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "Hello", want: "Hello"},
+		{text: "Grüße 20°C", want: "Gr\xF5\xE2e 20\xDFC"},
+		{text: "Café Ñandú", want: "Cafe Nandu"},
+		{text: "\x01 ok", want: "\x01 ok"},
+		{text: "a\\b~c\t日", want: "a?b?c??"},
+	}
+	for _, tt := range tests {
+		if got := string(toLCD(tt.text)); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDisplayMessageUTF8(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+
+	// 17 runes but 22 bytes, the last rune goes on the second row
+	if err := lcd.DisplayMessage("Déjà vu à Zürich!"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := conn.transfers()
+	if len(got) != 34 {
+		t.Fatalf("got %d transfers, want 34", len(got))
+	}
+	if got[0] != (lcdTransfer{value: 0x80}) || got[17] != (lcdTransfer{value: 0xC0}) {
+		t.Errorf("got row addresses %+v and %+v", got[0], got[17])
+	}
+
+	var first, second []byte
+	for _, tr := range got[1:17] {
+		first = append(first, tr.value)
+	}
+	for _, tr := range got[18:] {
+		second = append(second, tr.value)
+	}
+	if string(first) != "Deja vu a Z\xF5rich" {
+		t.Errorf("got first row %q", first)
+	}
+	if string(second) != "!               " {
+		t.Errorf("got second row %q", second)
+	}
+}
+
+func TestScrollFrame(t *testing.T) {
+	text := []byte("0123456789abcdefXYZ" + scrollGap)
+	tests := []struct {
+		offset int
+		want   string
+	}{
+		{offset: 0, want: "0123456789abcdef"},
+		{offset: 1, want: "123456789abcdefX"},
+		{offset: 10, want: "abcdefXYZ    012"},
+		{offset: 20, want: "   0123456789abc"},
+	}
+	for _, tt := range tests {
+		if got := string(scrollFrame(text, tt.offset, 16)); got != tt.want {
+			t.Errorf("offset %d: got %q, want %q", tt.offset, got, tt.want)
+		}
+	}
+
+	if got := string(scrollFrame([]byte("short"), 3, 16)); got != "short           " {
+		t.Errorf("got %q, want the short text padded", got)
+	}
+}
+
+func TestScrollMessage(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+
+	done := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		errs <- lcd.ScrollMessage(1, "DlSnIpEr in the mix", time.Millisecond, done)
+	}()
+
+	// each frame is the line address followed by 16 characters
+	deadline := time.Now().Add(5 * time.Second)
+	for len(conn.transfers()) < 3*17 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(done)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	got := conn.transfers()
+	if len(got) < 3*17 {
+		t.Fatalf("got %d transfers, want at least 3 frames", len(got))
+	}
+	for i, want := range []string{"DlSnIpEr in the ", "lSnIpEr in the m", "SnIpEr in the mi"} {
+		frame := got[i*17 : (i+1)*17]
+		if frame[0] != (lcdTransfer{value: 0xC0}) {
+			t.Errorf("frame %d: got address %+v, want the second line", i, frame[0])
+		}
+		var chars []byte
+		for _, tr := range frame[1:] {
+			chars = append(chars, tr.value)
+		}
+		if string(chars) != want {
+			t.Errorf("frame %d: got %q, want %q", i, chars, want)
+		}
+	}
+
+	if err := lcd.ScrollMessage(2, "msg", time.Millisecond, done); err == nil {
+		t.Error("expected an error for line 2")
+	}
+}
+
+func TestSetCursor(t *testing.T) {
+	tests := []struct {
+		visible, blink bool
+		want           byte
+	}{
+		{visible: false, blink: false, want: 0x0C},
+		{visible: false, blink: true, want: 0x0D},
+		{visible: true, blink: false, want: 0x0E},
+		{visible: true, blink: true, want: 0x0F},
+	}
+	for _, tt := range tests {
+		lcd, conn := newTestLCD(t)
+		if err := lcd.SetCursor(tt.visible, tt.blink); err != nil {
+			t.Fatal(err)
+		}
+		got := conn.transfers()
+		if len(got) != 1 || got[0] != (lcdTransfer{value: tt.want}) {
+			t.Errorf("visible %v blink %v: got %v, want command 0x%02x", tt.visible, tt.blink, got, tt.want)
+		}
+	}
+}
+
+func TestShift(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+
+	steps := []struct {
+		shift func(bool) error
+		left  bool
+		want  byte
+	}{
+		{shift: lcd.ShiftDisplay, left: true, want: 0x18},
+		{shift: lcd.ShiftDisplay, left: false, want: 0x1C},
+		{shift: lcd.ShiftCursor, left: true, want: 0x10},
+		{shift: lcd.ShiftCursor, left: false, want: 0x14},
+	}
+	for _, step := range steps {
+		conn.reset()
+		if err := step.shift(step.left); err != nil {
+			t.Fatal(err)
+		}
+		got := conn.transfers()
+		if len(got) != 1 || got[0] != (lcdTransfer{value: step.want}) {
+			t.Errorf("got %v, want command 0x%02x", got, step.want)
+		}
+	}
+}
+
+func TestBacklightTimeout(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+
+	backlight := func() bool {
+		lcd.mtx.Lock()
+		defer lcd.mtx.Unlock()
+		return lcd.backlightEnabled
+	}
+	waitBacklight := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for backlight() != want && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if backlight() != want {
+			t.Fatalf("got backlight %v, want %v", !want, want)
+		}
+	}
+
+	if err := lcd.SetBacklightTimeout(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := lcd.DisplayMessageWithCoordinates(0, 0, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if !backlight() {
+		t.Fatal("expected the backlight on after a message")
+	}
+
+	waitBacklight(false)
+	conn.mtx.Lock()
+	last := conn.written[len(conn.written)-1]
+	conn.mtx.Unlock()
+	if last&0x08 != 0 {
+		t.Errorf("got last write 0x%02x, want the backlight bit cleared", last)
+	}
+
+	if err := lcd.DisplayMessage("back on"); err != nil {
+		t.Fatal(err)
+	}
+	if !backlight() {
+		t.Error("expected the backlight on again after a message")
+	}
+	waitBacklight(false)
+
+	// removing the timeout turns the backlight on again
+	if err := lcd.SetBacklightTimeout(0); err != nil {
+		t.Fatal(err)
+	}
+	if !backlight() {
+		t.Error("expected the backlight on without timeout")
+	}
+}
+
+func TestDimensions(t *testing.T) {
+	tests := []struct {
+		cols, rows int
+		bases      []byte
+	}{
+		{cols: 16, rows: 2, bases: []byte{0x80, 0xC0}},
+		{cols: 20, rows: 4, bases: []byte{0x80, 0xC0, 0x94, 0xD4}},
+	}
+
+	for _, tt := range tests {
+		lcd, conn := newTestLCD(t, WithDimensions(tt.cols, tt.rows))
+
+		if err := lcd.DisplayMessage("x"); err != nil {
+			t.Fatal(err)
+		}
+		got := conn.transfers()
+		if len(got) != tt.rows*(tt.cols+1) {
+			t.Fatalf("%dx%d: got %d transfers, want %d", tt.cols, tt.rows, len(got), tt.rows*(tt.cols+1))
+		}
+		for row, base := range tt.bases {
+			if tr := got[row*(tt.cols+1)]; tr != (lcdTransfer{value: base}) {
+				t.Errorf("%dx%d: got row %d address %+v, want 0x%02x", tt.cols, tt.rows, row, tr, base)
+			}
+		}
+
+		// the coordinates are clamped to the last column and row
+		conn.reset()
+		if err := lcd.DisplayMessageWithCoordinates(99, 99, "x"); err != nil {
+			t.Fatal(err)
+		}
+		want := tt.bases[len(tt.bases)-1] + byte(tt.cols-1)
+		if got := conn.transfers(); got[0] != (lcdTransfer{value: want}) {
+			t.Errorf("%dx%d: got address %+v, want 0x%02x", tt.cols, tt.rows, got[0], want)
+		}
+	}
+
+	for _, dims := range [][2]int{{0, 2}, {16, 0}, {16, 5}, {41, 1}, {40, 4}} {
+		if _, err := NewLCD1602Driver(&lcdTestConnection{}, WithDimensions(dims[0], dims[1])); err == nil {
+			t.Errorf("expected an error for %dx%d", dims[0], dims[1])
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "DlSnIpEr in the mix tonight", want: []string{"DlSnIpEr in the", "mix tonight"}},
+		{text: "exactly sixteen! next", want: []string{"exactly sixteen!", "next"}},
+		{text: "  spaced   words  ", want: []string{"spaced words"}},
+		{text: "a supercalifragilisticexpialidocious word", want: []string{"a", "supercalifragili", "sticexpialidocio", "us word"}},
+		{text: "", want: nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, line := range wrapText([]byte(tt.text), 16) {
+			got = append(got, string(line))
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestDisplayWrapped(t *testing.T) {
+	rows := func(conn *lcdTestConnection) []string {
+		var res []string
+		var row []byte
+		for _, tr := range conn.transfers() {
+			if !tr.data {
+				if row != nil {
+					res = append(res, string(row))
+				}
+				row = []byte{}
+				continue
+			}
+			row = append(row, tr.value)
+		}
+		return append(res, string(row))
+	}
+
+	lcd, conn := newTestLCD(t)
+	if err := lcd.DisplayWrapped("DlSnIpEr in the mix"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rows(conn); len(got) != 2 || got[0] != "DlSnIpEr in the " || got[1] != "mix             " {
+		t.Errorf("got rows %q", got)
+	}
+
+	conn.reset()
+	if err := lcd.DisplayWrapped("one two three four five six seven"); err != ErrOverflow {
+		t.Errorf("got error %v, want %v", err, ErrOverflow)
+	}
+	if got := rows(conn); len(got) != 2 || got[0] != "one two three   " || got[1] != "four five six   " {
+		t.Errorf("got rows %q", got)
+	}
+
+	lcd, conn = newTestLCD(t, WithOverflow(OverflowScroll))
+	if err := lcd.DisplayWrapped("one two three four five six seven"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rows(conn); len(got) != 2 || got[0] != "four five six   " || got[1] != "seven           " {
+		t.Errorf("got rows %q", got)
+	}
+}
+
+func TestAlignText(t *testing.T) {
+	tests := []struct {
+		text  string
+		align Alignment
+		want  string
+	}{
+		{text: "FM", align: AlignLeft, want: "FM              "},
+		{text: "FM", align: AlignCenter, want: "       FM       "},
+		{text: "FM!", align: AlignCenter, want: "      FM!       "},
+		{text: "FM", align: AlignRight, want: "              FM"},
+		{text: "exactly sixteen!", align: AlignLeft, want: "exactly sixteen!"},
+		{text: "exactly sixteen!", align: AlignCenter, want: "exactly sixteen!"},
+		{text: "exactly sixteen!", align: AlignRight, want: "exactly sixteen!"},
+		{text: "more than sixteen", align: AlignRight, want: "more than sixtee"},
+	}
+	for _, tt := range tests {
+		if got := string(alignText([]byte(tt.text), 16, tt.align)); got != tt.want {
+			t.Errorf("%q aligned %d: got %q, want %q", tt.text, tt.align, got, tt.want)
+		}
+	}
+}
+
+func TestDisplayAligned(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+	if err := lcd.DisplayAligned(1, "12:30", AlignRight); err != nil {
+		t.Fatal(err)
+	}
+
+	got := conn.transfers()
+	if len(got) != 17 || got[0].data || got[0].value != 0xC0 {
+		t.Fatalf("got transfers %v, want the second row address and 16 characters", got)
+	}
+	var row []byte
+	for _, tr := range got[1:] {
+		row = append(row, tr.value)
+	}
+	if want := "           12:30"; string(row) != want {
+		t.Errorf("got row %q, want %q", row, want)
+	}
+
+	if err := lcd.DisplayAligned(2, "FM", AlignLeft); err == nil {
+		t.Error("expected an error for the line out of bounds")
+	}
+}
+
+func TestContents(t *testing.T) {
+	lcd, _ := newTestLCD(t)
+	if err := lcd.DisplayMessageWithCoordinates(3, 1, "95.5 MHz"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lcd.DisplayMessageWithCoordinates(0, 0, "DLSNIPER"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lcd.DefineCustomChar(0, [8]byte{0x1F}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"DLSNIPER        ", "   95.5 MHz     "}
+	if got := lcd.Contents(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got contents %q, want %q", got, want)
+	}
+
+	if err := lcd.ClearScreen(); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"                ", "                "}
+	if got := lcd.Contents(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got contents %q after clearing, want %q", got, want)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+	if err := lcd.Update(1, "12:30:58"); err != nil {
+		t.Fatal(err)
+	}
+	conn.reset()
+
+	if err := lcd.Update(1, "12:30:59"); err != nil {
+		t.Fatal(err)
+	}
+	want := []lcdTransfer{{value: 0xC7}, {data: true, value: '9'}}
+	if got := conn.transfers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got transfers %v, want %v", got, want)
+	}
+
+	conn.reset()
+	if err := lcd.Update(1, "12:31:00"); err != nil {
+		t.Fatal(err)
+	}
+	want = []lcdTransfer{
+		{value: 0xC4}, {data: true, value: '1'},
+		{value: 0xC6}, {data: true, value: '0'}, {data: true, value: '0'},
+	}
+	if got := conn.transfers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got transfers %v, want %v", got, want)
+	}
+
+	conn.reset()
+	if err := lcd.Update(1, "12:31:00"); err != nil {
+		t.Fatal(err)
+	}
+	if got := conn.transfers(); len(got) != 0 {
+		t.Errorf("got transfers %v, want none for the same contents", got)
+	}
+
+	if got := lcd.Contents()[1]; got != "12:31:00        " {
+		t.Errorf("got contents %q", got)
+	}
+}
+
+func TestUpdateAfterShiftCursor(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+	if err := lcd.Update(1, "12:30:58"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cursor moves past the cell following the text
+	if err := lcd.ShiftCursor(false); err != nil {
+		t.Fatal(err)
+	}
+	conn.reset()
+	if err := lcd.Update(1, "12:30:58!"); err != nil {
+		t.Fatal(err)
+	}
+	want := []lcdTransfer{{value: 0xC8}, {data: true, value: '!'}}
+	if got := conn.transfers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got transfers %v, want %v", got, want)
+	}
+
+	// back on the last cell of the text, after the '!'
+	for i := 0; i < 2; i++ {
+		if err := lcd.ShiftCursor(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.reset()
+	if err := lcd.Update(1, "12:30:59!"); err != nil {
+		t.Fatal(err)
+	}
+	want = []lcdTransfer{{data: true, value: '9'}}
+	if got := conn.transfers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got transfers %v, want %v", got, want)
+	}
+	if got := lcd.Contents()[1]; got != "12:30:59!       " {
+		t.Errorf("got contents %q", got)
+	}
+
+	// the cursor wraps from the start of the second line to the end of the first one
+	if err := lcd.sendCommand(0xC0); err != nil {
+		t.Fatal(err)
+	}
+	if err := lcd.ShiftCursor(true); err != nil {
+		t.Fatal(err)
+	}
+	if lcd.ddramAddr != 0x27 {
+		t.Errorf("got address 0x%02x, want 0x27", lcd.ddramAddr)
+	}
+}
+
+func TestProgressCells(t *testing.T) {
+	tests := []struct {
+		fraction float64
+		want     string
+	}{
+		{fraction: 0, want: "                "},
+		{fraction: -0.5, want: "                "},
+		{fraction: 0.1, want: "\xff\x02              "},
+		{fraction: 0.5, want: "\xff\xff\xff\xff\xff\xff\xff\xff        "},
+		{fraction: 0.51, want: "\xff\xff\xff\xff\xff\xff\xff\xff\x00       "},
+		{fraction: 1, want: "\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff"},
+		{fraction: 2, want: "\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff"},
+	}
+	for _, tt := range tests {
+		if got := string(progressCells(tt.fraction, 16)); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.fraction, got, tt.want)
+		}
+	}
+}
+
+func TestDisplayProgress(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+	if err := lcd.DisplayProgress(0, 0.5); err != nil {
+		t.Fatal(err)
+	}
+
+	got := conn.transfers()
+	if len(got) != 4*9+17 {
+		t.Fatalf("got %d transfers, want 4 glyphs and a line: %v", len(got), got)
+	}
+	for slot, row := range []byte{0x10, 0x18, 0x1C, 0x1E} {
+		glyph := got[slot*9 : (slot+1)*9]
+		if glyph[0] != (lcdTransfer{value: byte(0x40 | slot<<3)}) || glyph[1] != (lcdTransfer{data: true, value: row}) {
+			t.Errorf("got glyph %d as %v, want rows 0x%02X", slot, glyph, row)
+		}
+	}
+	if want := "\xff\xff\xff\xff\xff\xff\xff\xff        "; lcd.Contents()[0] != want {
+		t.Errorf("got contents %q, want %q", lcd.Contents()[0], want)
+	}
+
+	// The glyphs are defined once
+	conn.reset()
+	if err := lcd.DisplayProgress(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := conn.transfers(); len(got) != 17 {
+		t.Errorf("got %d transfers, want the line only", len(got))
+	}
+
+	if err := lcd.DisplayProgress(2, 1); err == nil {
+		t.Error("expected an error for the line out of bounds")
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+
+	var wg sync.WaitGroup
+	for _, letter := range "ABC" {
+		wg.Add(1)
+		go func(msg string) {
+			defer wg.Done()
+			for i := 0; i < 3; i++ {
+				if err := lcd.DisplayMessageWithCoordinates(0, 0, msg); err != nil {
+					t.Error(err)
+				}
+			}
+		}(strings.Repeat(string(letter), 4))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := lcd.ClearScreen(); err != nil {
+			t.Error(err)
+		}
+	}()
+	wg.Wait()
+
+	// Every byte must be sent as two whole nibbles, when not a backlight write
+	conn.mtx.Lock()
+	written := conn.written
+	conn.mtx.Unlock()
+	var got []lcdTransfer
+	for i := 0; i < len(written); {
+		if written[i]&0x04 == 0 {
+			i++
+			continue
+		}
+		if i+3 >= len(written) || written[i+1] != written[i]&^0x04 ||
+			written[i+2]&0x05 != written[i]&0x05 || written[i+3] != written[i+2]&^0x04 {
+			t.Fatalf("got interleaved nibbles at %d: % X", i, written[i:])
+		}
+		got = append(got, lcdTransfer{data: written[i]&0x01 != 0, value: written[i]&0xF0 | written[i+2]>>4})
+		i += 4
+	}
+
+	// The messages must not be interleaved either
+	for i := 0; i < len(got); i++ {
+		if got[i] == (lcdTransfer{value: 0x01}) {
+			continue
+		}
+		if got[i] != (lcdTransfer{value: 0x80}) || i+4 >= len(got) {
+			t.Fatalf("got %v at %d, want a cursor move and a message", got[i:], i)
+		}
+		for _, tr := range got[i+2 : i+5] {
+			if tr != got[i+1] {
+				t.Fatalf("got message %v, want the same letter", got[i+1:i+5])
+			}
+		}
+		i += 4
+	}
+}
+
+func TestBacklightBits(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+	written := func() []byte {
+		conn.mtx.Lock()
+		defer conn.mtx.Unlock()
+		res := conn.written
+		conn.written = nil
+		return res
+	}
+
+	if err := lcd.SetCursor(false, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := written(), []byte{0x0C, 0x08, 0xCC, 0xC8}; !bytes.Equal(got, want) {
+		t.Errorf("got % X with the backlight on, want % X", got, want)
+	}
+
+	if err := lcd.DisableBacklight(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := written(), []byte{0x00}; !bytes.Equal(got, want) {
+		t.Errorf("got % X when disabling the backlight, want % X", got, want)
+	}
+
+	if err := lcd.SetCursor(false, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := written(), []byte{0x04, 0x00, 0xC4, 0xC0}; !bytes.Equal(got, want) {
+		t.Errorf("got % X with the backlight off, want % X", got, want)
+	}
+
+	if err := lcd.EnableBacklight(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := written(), []byte{0x08}; !bytes.Equal(got, want) {
+		t.Errorf("got % X when enabling the backlight, want % X", got, want)
+	}
+}
+
+func TestBlinkMessage(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+	if err := lcd.DisplayAligned(0, "95.5 MHz", AlignCenter); err != nil {
+		t.Fatal(err)
+	}
+	conn.reset()
+
+	if err := lcd.BlinkMessage(0, "ALERT", 3, time.Millisecond, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// each cycle shows and clears the line, then the line is restored
+	got := conn.transfers()
+	want := []string{
+		"ALERT           ", "                ",
+		"ALERT           ", "                ",
+		"ALERT           ", "                ",
+		"    95.5 MHz    ",
+	}
+	if len(got) != len(want)*17 {
+		t.Fatalf("got %d transfers, want %d lines", len(got), len(want))
+	}
+	for i := range want {
+		var chars []byte
+		for _, tr := range got[i*17+1 : (i+1)*17] {
+			chars = append(chars, tr.value)
+		}
+		if string(chars) != want[i] {
+			t.Errorf("line %d: got %q, want %q", i, chars, want[i])
+		}
+	}
+
+	done := make(chan struct{})
+	close(done)
+	conn.reset()
+	if err := lcd.BlinkMessage(0, "ALERT", 100, time.Hour, done); err != nil {
+		t.Fatal(err)
+	}
+	if got := conn.transfers(); len(got) != 2*17 {
+		t.Errorf("got %d transfers, want the message and the restored line", len(got))
+	}
+
+	if err := lcd.BlinkMessage(0, "ALERT", 0, time.Millisecond, nil); err == nil {
+		t.Error("expected an error for zero times")
+	}
+}
+
+func TestWriteCharAt(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+	tests := []struct {
+		x, y int
+		ch   rune
+		want []lcdTransfer
+	}{
+		{x: 15, y: 1, ch: '|', want: []lcdTransfer{{value: 0xCF}, {data: true, value: '|'}}},
+		{x: 3, y: 0, ch: '°', want: []lcdTransfer{{value: 0x83}, {data: true, value: 0xDF}}},
+		{x: 20, y: 5, ch: '/', want: []lcdTransfer{{value: 0xCF}, {data: true, value: '/'}}},
+		{x: -1, y: -1, ch: '-', want: []lcdTransfer{{value: 0x80}, {data: true, value: '-'}}},
+	}
+	for _, tt := range tests {
+		conn.reset()
+		if err := lcd.WriteCharAt(tt.x, tt.y, tt.ch); err != nil {
+			t.Fatal(err)
+		}
+		if got := conn.transfers(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q at %d, %d: got transfers %v, want %v", tt.ch, tt.x, tt.y, got, tt.want)
+		}
+	}
+
+	want := []string{"-  \xdf            ", "               /"}
+	if got := lcd.Contents(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got contents %q, want %q", got, want)
+	}
+}
+
+func TestAddress(t *testing.T) {
+	_, conn := newTestLCD(t)
+	if conn.address != 0x27 {
+		t.Errorf("got address 0x%02x, want the default 0x27", conn.address)
+	}
+
+	_, conn = newTestLCD(t, i2c.WithAddress(0x3F))
+	if conn.address != 0x3F {
+		t.Errorf("got address 0x%02x, want 0x3F", conn.address)
+	}
+
+	for _, addr := range []int{0x07, 0x78, 0x100} {
+		if _, err := NewLCD1602Driver(&lcdTestConnection{}, i2c.WithAddress(addr)); err == nil {
+			t.Errorf("expected an error for address 0x%02x", addr)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	lcd, _ := newTestLCD(t)
+	if !strings.HasPrefix(lcd.Name(), "SunFounderLCD1602Driver-") {
+		t.Errorf("got name %q, want the default one", lcd.Name())
+	}
+
+	lcd, _ = newTestLCD(t, WithName("studio"))
+	if lcd.Name() != "studio" {
+		t.Errorf("got name %q, want %q", lcd.Name(), "studio")
+	}
+}
+
+func TestStartSpinner(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+	if err := lcd.WriteCharAt(15, 0, '*'); err != nil {
+		t.Fatal(err)
+	}
+	conn.reset()
+
+	stop := lcd.StartSpinner(15, 0)
+	// the backslash glyph definition, then the address and glyph of each frame
+	deadline := time.Now().Add(5 * time.Second)
+	for len(conn.transfers()) < 9+5*2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+	stop()
+
+	got := conn.transfers()
+	if len(got) < 9+5*2 || got[0] != (lcdTransfer{value: 0x78}) {
+		t.Fatalf("got transfers %v, want the glyph definition and 5 frames", got)
+	}
+	frames := got[9:]
+	for i, want := range []byte{'|', '/', '-', 7, '|'} {
+		if frames[2*i] != (lcdTransfer{value: 0x8F}) || frames[2*i+1] != (lcdTransfer{data: true, value: want}) {
+			t.Errorf("frame %d: got %v, want glyph %q", i, frames[2*i:2*i+2], want)
+		}
+	}
+
+	if last := frames[len(frames)-1]; last != (lcdTransfer{data: true, value: '*'}) {
+		t.Errorf("got last transfer %v, want the cell restored", last)
+	}
+	if got := lcd.Contents()[0]; got != "               *" {
+		t.Errorf("got contents %q after stopping", got)
+	}
+}
+
+func TestHalt(t *testing.T) {
+	lcd, conn := newTestLCD(t)
+	if err := lcd.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	conn.mtx.Lock()
+	written := conn.written
+	conn.mtx.Unlock()
+	if want := []byte{0x00, 0x04, 0x00, 0x14, 0x10}; !bytes.Equal(written, want) {
+		t.Errorf("got % X, want the backlight off then the clear command", written)
+	}
+
+	lcd, conn = newTestLCD(t, WithHaltMessage("Shutting down"))
+	if err := lcd.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	got := conn.transfers()
+	conn.mtx.Lock()
+	written = conn.written
+	conn.mtx.Unlock()
+	// every write is a nibble of the message, with the backlight on
+	if len(written) != 4*len(got) {
+		t.Errorf("got %d writes for %d transfers, want no backlight writes", len(written), len(got))
+	}
+	for _, w := range written {
+		if w&0x08 == 0 {
+			t.Fatalf("got write 0x%02X, want the backlight kept on", w)
+		}
+	}
+	want := []string{"Shutting down   ", "                "}
+	if contents := lcd.Contents(); !reflect.DeepEqual(contents, want) {
+		t.Errorf("got contents %q, want %q", contents, want)
+	}
+}
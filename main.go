@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"fmradio/display"
@@ -12,30 +16,39 @@ import (
 	"gobot.io/x/gobot/platforms/raspi"
 )
 
-func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-
-	stationName := "DlSnIpEr Inc."
-	rdsMessage := "DlSnIpEr in the mix"
-
-	adaptor := raspi.NewAdaptor()
+const (
+	// stationName is the RDS station name, up to 8 characters
+	stationName = "DLSNIPER"
+	rdsMessage  = "DlSnIpEr in the mix"
+)
 
-	radioConfig := radio.Si4713Config{
+// stationConfig is the configuration of the transmitter.
+func stationConfig() radio.Si4713Config {
+	return radio.Si4713Config{
 		TransmitFrequency: 9550,
 		TransmitPower:     115,
 		HasRDS:            true,
 		RDSProgramID:      0x3104,
 		RDSStationName:    stationName,
 		RDSMessage:        rdsMessage,
+		FadeOnHalt:        true,
 		Log:               log.Printf,
 	}
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	adaptor := raspi.NewAdaptor()
+
+	radioConfig := stationConfig()
 
 	rdio, err := radio.NewSi4713Driver(adaptor, radioConfig)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	lcd, err := display.NewLCD1602Driver(adaptor)
+	lcd, err := display.NewLCD1602Driver(adaptor, display.WithHaltMessage("Shutting down"))
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -73,7 +86,34 @@ func main() {
 		work,
 	)
 
-	if err = robot.Start(); err != nil {
+	// the signals are handled by run rather than by the robot
+	robot.AutoRun = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	if err = run(ctx, robot); err != nil {
 		log.Fatalln(err)
 	}
 }
+
+// robot is the part of gobot.Robot used by run.
+type robot interface {
+	Start(args ...interface{}) error
+	Stop() error
+}
+
+// run starts the robot then stops it, halting the devices, once the context is done.
+func run(ctx context.Context, r robot) error {
+	if err := r.Start(); err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	return r.Stop()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gobot.io/x/gobot"
+)
+
+type fakeDevice struct {
+	name    string
+	started bool
+	halted  bool
+}
+
+func (d *fakeDevice) Name() string                 { return d.name }
+func (d *fakeDevice) SetName(name string)          { d.name = name }
+func (d *fakeDevice) Start() error                 { d.started = true; return nil }
+func (d *fakeDevice) Halt() error                  { d.halted = true; return nil }
+func (d *fakeDevice) Connection() gobot.Connection { return nil }
+
+func TestStationConfig(t *testing.T) {
+	cfg := stationConfig()
+	cfg.Log = t.Logf
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunHaltsOnCancel(t *testing.T) {
+	device := &fakeDevice{name: "radio"}
+	r := gobot.NewRobot("test", []gobot.Device{device})
+	r.AutoRun = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- run(ctx, r)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run did not return after the cancellation")
+	}
+
+	if !device.started || !device.halted {
+		t.Errorf("got started %v and halted %v, want both", device.started, device.halted)
+	}
+}
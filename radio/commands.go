@@ -0,0 +1,71 @@
+package radio
+
+import "fmt"
+
+// addCommands registers the commands available through the gobot API.
+//
+// The numbers are read from the JSON params:
+//
+//	SetFrequency: {"frequency": 9550}, in 10 kHz units
+//	SetPower: {"power": 115}, in dBuV
+//	SetRDSMessage: {"message": "DlSnIpEr in the mix"}
+//	TuneStatus: no params, returns the TuneStatus
+//
+// Each command returns the error, if any.
+func (s *Si4713Driver) addCommands() {
+	s.AddCommand("SetFrequency", func(params map[string]interface{}) interface{} {
+		freq, err := uintParam(params, "frequency", 0xFFFF)
+		if err != nil {
+			return err
+		}
+		return s.SetTransmitFrequency(uint16(freq))
+	})
+
+	s.AddCommand("SetPower", func(params map[string]interface{}) interface{} {
+		pwr, err := uintParam(params, "power", 0xFF)
+		if err != nil {
+			return err
+		}
+		return s.SetTransmitPower(uint8(pwr))
+	})
+
+	s.AddCommand("SetRDSMessage", func(params map[string]interface{}) interface{} {
+		msg, ok := params["message"].(string)
+		if !ok {
+			return fmt.Errorf("missing string param %q", "message")
+		}
+		return s.SetRDSMessage(msg)
+	})
+
+	s.AddCommand("TuneStatus", func(map[string]interface{}) interface{} {
+		status, err := s.GetTuneStatus()
+		if err != nil {
+			return err
+		}
+		return status
+	})
+}
+
+// uintParam reads a positive integer param up to max. JSON numbers are decoded as float64.
+func uintParam(params map[string]interface{}, name string, max uint64) (uint64, error) {
+	var val uint64
+	switch v := params[name].(type) {
+	case float64:
+		if v < 0 || v != float64(uint64(v)) {
+			return 0, fmt.Errorf("param %q is not a positive integer: %v", name, v)
+		}
+		val = uint64(v)
+	case int:
+		if v < 0 {
+			return 0, fmt.Errorf("param %q is not a positive integer: %v", name, v)
+		}
+		val = uint64(v)
+	default:
+		return 0, fmt.Errorf("missing number param %q", name)
+	}
+
+	if val > max {
+		return 0, fmt.Errorf("param %q is larger than %d: %d", name, max, val)
+	}
+	return val, nil
+}
@@ -0,0 +1,28 @@
+package radio
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// LoadConfig parses a JSON configuration, then validates it.
+// The keys are the Si4713Config field names, e.g. {"TransmitFrequency": 9550},
+// and the durations are in nanoseconds.
+// The logging functions and the callbacks can't be loaded and must be
+// set on the returned configuration.
+func LoadConfig(r io.Reader) (Si4713Config, error) {
+	var cfg Si4713Config
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return Si4713Config{}, err
+	}
+
+	// the logging functions are not set yet, so DebugMode can't require
+	// DebugLog here and the adjustments are not logged
+	if err := cfg.validate(funcLogger{}); err != nil {
+		return Si4713Config{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,91 @@
+package radio
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(strings.NewReader(`{
+		"TransmitFrequency": 9550,
+		"TransmitPower": 115,
+		"HasRDS": true,
+		"RDSProgramID": 12548,
+		"RDSStationName": "DLSNIPER",
+		"RDSMessage": "DlSnIpEr in the mix",
+		"PreEmphasis": 1,
+		"CommandTimeout": 200000000,
+		"Compressor": {"Enable": true, "Limiter": true, "ThresholdDB": -20, "GainDB": 15, "ReleaseTime": 4, "LimiterReleaseTime": 102}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.TransmitFrequency != 9550 || cfg.TransmitPower != 115 {
+		t.Errorf("got %d at %d dBuV", cfg.TransmitFrequency, cfg.TransmitPower)
+	}
+	if !cfg.HasRDS || cfg.RDSProgramID != 0x3104 || cfg.RDSStationName != "DLSNIPER" || cfg.RDSMessage != "DlSnIpEr in the mix" {
+		t.Errorf("got RDS %v 0x%x %q %q", cfg.HasRDS, cfg.RDSProgramID, cfg.RDSStationName, cfg.RDSMessage)
+	}
+	if cfg.PreEmphasis != PreEmphasis50us || cfg.CommandTimeout != 200*time.Millisecond {
+		t.Errorf("got pre-emphasis %d and command timeout %v", cfg.PreEmphasis, cfg.CommandTimeout)
+	}
+	if cfg.Compressor == nil || cfg.Compressor.ThresholdDB != -20 || cfg.Compressor.GainDB != 15 {
+		t.Errorf("got compressor %+v", cfg.Compressor)
+	}
+
+	// defaults are filled in by the validation
+	if cfg.TuneTimeout != 500*time.Millisecond || cfg.AudioDeviationHz != 66250 {
+		t.Errorf("got tune timeout %v and audio deviation %d", cfg.TuneTimeout, cfg.AudioDeviationHz)
+	}
+
+	// the logging functions can be set afterwards
+	var logged []string
+	cfg.Log = func(format string, v ...interface{}) { logged = append(logged, format) }
+	cfg.TransmitPower = 120
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 1 {
+		t.Errorf("got %d messages logged, want 1", len(logged))
+	}
+}
+
+func TestLoadConfigDebugMode(t *testing.T) {
+	cfg, err := LoadConfig(strings.NewReader(`{"TransmitFrequency": 9550, "DebugMode": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.DebugMode || cfg.Logger != nil {
+		t.Errorf("got debugging mode %v and logger %v, want the mode without a logger", cfg.DebugMode, cfg.Logger)
+	}
+
+	// the DebugLog function is still required once running
+	if err := cfg.Validate(); !errors.Is(err, ErrNilLogger) {
+		t.Errorf("got error %v, want %v", err, ErrNilLogger)
+	}
+
+	var logged []string
+	cfg.DebugLog = func(format string, v ...interface{}) { logged = append(logged, format) }
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Logger.Debugf("hello\n")
+	if len(logged) != 1 {
+		t.Errorf("got %d debugging messages, want 1", len(logged))
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	if _, err := LoadConfig(strings.NewReader(`{"TransmitFrequency": 12000}`)); !errors.Is(err, ErrFrequencyOutOfRange) {
+		t.Errorf("got error %v, want %v", err, ErrFrequencyOutOfRange)
+	}
+	if _, err := LoadConfig(strings.NewReader(`{"TransmitFrequency": 9550, "Frequency": 9550}`)); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+	if _, err := LoadConfig(strings.NewReader(`{"TransmitFrequency": "95.5"}`)); err == nil {
+		t.Error("expected an error for a malformed value")
+	}
+}
@@ -0,0 +1,73 @@
+package radio
+
+import "fmt"
+
+// DiagnosticCheck is the result of one of the SelfTest checks.
+type DiagnosticCheck struct {
+	// Name identifies the check, e.g. "cts" or "part number"
+	Name string
+
+	// Err is the reason of the failure, nil when the check passed
+	Err error
+}
+
+// Passed reports whether the check passed.
+func (c DiagnosticCheck) Passed() bool {
+	return c.Err == nil
+}
+
+// DiagnosticReport holds the results of SelfTest.
+type DiagnosticReport struct {
+	// Checks holds the result of each check, in the order they ran
+	Checks []DiagnosticCheck
+
+	// Revision is the hardware revision read from the device
+	Revision Revision
+
+	// TuneStatus is the tune status read from the device
+	TuneStatus TuneStatus
+}
+
+// Passed reports whether all the checks passed.
+func (r DiagnosticReport) Passed() bool {
+	return r.Err() == nil
+}
+
+// Err returns the error of the first failed check, if any.
+func (r DiagnosticReport) Err() error {
+	for _, c := range r.Checks {
+		if !c.Passed() {
+			return fmt.Errorf("%s check failed: %w", c.Name, c.Err)
+		}
+	}
+	return nil
+}
+
+func (r *DiagnosticReport) check(name string, err error) {
+	r.Checks = append(r.Checks, DiagnosticCheck{Name: name, Err: err})
+}
+
+// SelfTest checks that the running device answers with CTS, reads
+// its revision, verifies it is an Si4713 and reads its tune status.
+// All the checks run, even after a failure, and the returned error
+// is the one of the first failed check, see DiagnosticReport.Err.
+func (s *Si4713Driver) SelfTest() (DiagnosticReport, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var report DiagnosticReport
+	report.check("cts", s.sendCommand(command{CMD_GET_INT_STATUS}))
+
+	rev, err := s.revision()
+	report.Revision = rev
+	report.check("revision", err)
+	if err == nil && rev.PartNumber != 13 {
+		err = fmt.Errorf("found an Si47%02d", rev.PartNumber)
+	}
+	report.check("part number", err)
+
+	report.TuneStatus, err = s.tuneStatus()
+	report.check("tune status", err)
+
+	return report, report.Err()
+}
@@ -0,0 +1,44 @@
+package radio
+
+import (
+	"testing"
+
+	"fmradio/radio/radiotest"
+)
+
+func TestSelfTest(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_GET_REV:        {STATUS_CTS, STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3},
+		CMD_TX_TUNE_STATUS: {STATUS_CTS, STATUS_CTS, 0, 0x25, 0x4E, 0, 115, 42, 17},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	report, err := s.SelfTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Passed() || len(report.Checks) != 4 {
+		t.Errorf("got checks %+v, want 4 passed", report.Checks)
+	}
+	if report.Revision.PartNumber != 13 || report.TuneStatus.FrequencyKHz != 9550 {
+		t.Errorf("got revision %+v and tune status %+v", report.Revision, report.TuneStatus)
+	}
+
+	adaptor = radiotest.NewAdaptor(map[byte][]byte{
+		CMD_GET_REV: {STATUS_CTS, STATUS_CTS, 21, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3},
+	})
+	s = newTestDriver(t, adaptor, Si4713Config{})
+
+	report, err = s.SelfTest()
+	if err == nil || report.Passed() {
+		t.Fatal("expected a failure for an Si4721")
+	}
+	for _, c := range report.Checks {
+		if c.Passed() != (c.Name != "part number") {
+			t.Errorf("check %q: got error %v", c.Name, c.Err)
+		}
+	}
+	if report.Revision.PartNumber != 21 {
+		t.Errorf("got part number %d, want 21", report.Revision.PartNumber)
+	}
+}
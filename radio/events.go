@@ -0,0 +1,40 @@
+package radio
+
+// The events published through the gobot Eventer, e.g. with
+// driver.On(radio.EventTuned, func(data interface{}) { ... }).
+const (
+	// EventTuned is published once the transmission frequency changed.
+	// The data is the new frequency, a uint16 in 10 kHz units.
+	EventTuned = "tuned"
+
+	// EventPowerChanged is published once the transmission power changed.
+	// The data is the new power, a uint8 in dBuV.
+	EventPowerChanged = "power-changed"
+
+	// EventRDSUpdated is published once an RDS text was loaded.
+	// The data is the text, or the []string names for SetRDSStations.
+	EventRDSUpdated = "rds-updated"
+
+	// EventSilenceDetected is published from Loop when the input audio
+	// stayed silent, see OnSilence. There is no data.
+	EventSilenceDetected = "silence-detected"
+)
+
+// addEvents registers the events published by the driver.
+func (s *Si4713Driver) addEvents() {
+	s.AddEvent(EventTuned)
+	s.AddEvent(EventPowerChanged)
+	s.AddEvent(EventRDSUpdated)
+	s.AddEvent(EventSilenceDetected)
+}
+
+// publish publishes the event when err is nil, then returns err.
+// It is called unlocked: the Eventer buffers the events, but a subscriber
+// which doesn't keep up eventually blocks it, and must not block the i2c
+// transactions of the other goroutines too.
+func (s *Si4713Driver) publish(err error, name string, data interface{}) error {
+	if err == nil {
+		s.Publish(name, data)
+	}
+	return err
+}
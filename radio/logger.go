@@ -0,0 +1,39 @@
+package radio
+
+// Logger receives the log messages produced by the driver.
+// The debugging messages are only produced with DebugMode.
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// PrintfLogger adapts a printf-like function, e.g. log.Printf, to a Logger.
+// All the levels are sent to the same function.
+func PrintfLogger(printf func(format string, v ...interface{})) Logger {
+	return funcLogger{debug: printf, info: printf}
+}
+
+// funcLogger adapts the Log and DebugLog functions of Si4713Config to a Logger.
+type funcLogger struct {
+	debug func(format string, v ...interface{})
+	info  func(format string, v ...interface{})
+}
+
+func (l funcLogger) Debugf(format string, v ...interface{}) {
+	if l.debug != nil {
+		l.debug(format, v...)
+	}
+}
+
+func (l funcLogger) Infof(format string, v ...interface{}) {
+	if l.info != nil {
+		l.info(format, v...)
+	}
+}
+
+func (l funcLogger) Errorf(format string, v ...interface{}) {
+	if l.info != nil {
+		l.info(format, v...)
+	}
+}
@@ -0,0 +1,81 @@
+// Package metrics exposes the Si4713 transmitter state as Prometheus gauges.
+//
+// The gauges are read from the device on each scrape and served
+// in the Prometheus text format:
+//
+//	http.Handle("/metrics", metrics.Handler(rdio))
+//	log.Fatalln(http.ListenAndServe(":2112", nil))
+//
+// Gauges can be used with another registry, e.g. from a custom
+// prometheus.Collector, to avoid serving them separately.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"fmradio/radio"
+)
+
+// Source reads the transmitter state, e.g. a *radio.Si4713Driver.
+type Source interface {
+	GetTuneStatus() (radio.TuneStatus, error)
+	ReadDeviceStatus() (radio.DeviceStatus, error)
+}
+
+var _ Source = (*radio.Si4713Driver)(nil)
+
+// Gauge is a metric value at the time of the scrape.
+type Gauge struct {
+	Name  string
+	Help  string
+	Value float64
+}
+
+// Gauges reads the current transmitter state from the source.
+func Gauges(src Source) ([]Gauge, error) {
+	tune, err := src.GetTuneStatus()
+	if err != nil {
+		return nil, err
+	}
+	dev, err := src.ReadDeviceStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	return []Gauge{
+		{Name: "fmradio_frequency_mhz", Help: "Transmission frequency in MHz.", Value: radio.RawToMHz(tune.FrequencyKHz)},
+		{Name: "fmradio_power_dbuv", Help: "Transmission power in dBuV.", Value: float64(tune.PowerDBuV)},
+		{Name: "fmradio_antenna_capacitor", Help: "Antenna tuning capacitor value.", Value: float64(tune.AntennaCap)},
+		{Name: "fmradio_noise_level_dbuv", Help: "Received noise level in dBuV, after a measurement.", Value: float64(tune.NoiseLevel)},
+		{Name: "fmradio_rds_fifo_used", Help: "Used blocks in the RDS FIFO.", Value: float64(dev.FifoUsed)},
+		{Name: "fmradio_rds_fifo_available", Help: "Free blocks in the RDS FIFO.", Value: float64(dev.FifoAvailable)},
+		{Name: "fmradio_rds_circular_used", Help: "Used blocks in the RDS circular buffer.", Value: float64(dev.CircularUsed)},
+		{Name: "fmradio_rds_circular_available", Help: "Free blocks in the RDS circular buffer.", Value: float64(dev.CircularAvailable)},
+	}, nil
+}
+
+// Write writes the gauges in the Prometheus text format.
+func Write(w io.Writer, gauges []Gauge) error {
+	for _, g := range gauges {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", g.Name, g.Help, g.Name, g.Name, g.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the gauges read from the source on each request.
+func Handler(src Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		gauges, err := Gauges(src)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = Write(w, gauges)
+	})
+}
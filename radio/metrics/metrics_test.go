@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fmradio/radio"
+)
+
+type fakeSource struct {
+	tune radio.TuneStatus
+	dev  radio.DeviceStatus
+	err  error
+}
+
+func (f fakeSource) GetTuneStatus() (radio.TuneStatus, error) {
+	return f.tune, f.err
+}
+
+func (f fakeSource) ReadDeviceStatus() (radio.DeviceStatus, error) {
+	return f.dev, f.err
+}
+
+func TestHandler(t *testing.T) {
+	src := fakeSource{
+		tune: radio.TuneStatus{FrequencyKHz: 9555, PowerDBuV: 115, AntennaCap: 4, NoiseLevel: 12},
+		dev:  radio.DeviceStatus{CircularAvailable: 20, CircularUsed: 12, FifoAvailable: 4, FifoUsed: 6},
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(src).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"fmradio_frequency_mhz 95.55",
+		"fmradio_power_dbuv 115",
+		"fmradio_antenna_capacitor 4",
+		"fmradio_noise_level_dbuv 12",
+		"fmradio_rds_fifo_used 6",
+		"fmradio_rds_fifo_available 4",
+		"fmradio_rds_circular_used 12",
+		"fmradio_rds_circular_available 20",
+		"# TYPE fmradio_power_dbuv gauge",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestHandlerError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler(fakeSource{err: errors.New("bus error")}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -16,7 +16,11 @@
 package radio
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"gobot.io/x/gobot"
@@ -41,6 +45,37 @@ const (
 
 	// DEFAULT_RDS_PROGRAM_ID holds some random default for the RDS program ID
 	DEFAULT_RDS_PROGRAM_ID = 0xADAF
+
+	// DefaultRDSProgramID replaces a zero RDSProgramID, see RequireRDSProgramID.
+	DefaultRDSProgramID = 0x3104
+)
+
+var (
+	// ErrNilLogger is returned when the debugging mode is used without a DebugLog function.
+	ErrNilLogger = errors.New("cannot use debugging mode without configuring a DebugLog function, e.g. log.Printf")
+
+	// ErrRadioNotFound is returned by Start when the device doesn't answer as a Si4713.
+	ErrRadioNotFound = errors.New("couldn't find radio")
+
+	// ErrStoppedAfterScan is returned by Start when StopAfterFrequencyScan is set.
+	// Use ScanOnly to get the scan results instead.
+	ErrStoppedAfterScan = errors.New("forced stop due to configuration option")
+
+	// ErrNoProgramID is returned by Validate for a zero RDSProgramID with RequireRDSProgramID.
+	ErrNoProgramID = errors.New("RDS program ID not set, 0x0000 is reserved")
+
+	// ErrNoDigitalWriter is returned when resetting the device through
+	// an i2c connector which can't drive the reset pin.
+	ErrNoDigitalWriter = errors.New("i2c connector does not have a digital writer capability")
+
+	// ErrFrequencyOutOfRange is returned for frequencies outside of the FM band.
+	ErrFrequencyOutOfRange = errors.New("FM frequency not in 87.50 MHz ... 108 MHz bounds")
+
+	// ErrTuneMismatch is returned by TuneAndVerify when the device reports another frequency.
+	ErrTuneMismatch = errors.New("device did not tune to the requested frequency")
+
+	// ErrRDSFIFOFull is returned when the RDS FIFO has no room left for a group.
+	ErrRDSFIFOFull = errors.New("RDS FIFO full")
 )
 
 // Different command identifiers that the transmitter supports.
@@ -111,7 +146,7 @@ const (
 	PROP_DIGITAL_INPUT_FORMAT = 0x0101
 
 	// PROP_DIGITAL_INPUT_SAMPLE_RATE configures the digital input
-	// sample rate in 10 Hz steps.
+	// sample rate in 1 Hz steps.
 	// Default is 0 Hz.
 	PROP_DIGITAL_INPUT_SAMPLE_RATE = 0x0103
 
@@ -236,11 +271,72 @@ const (
 	PROP_TX_RDS_FIFO_SIZE = 0x2C07
 )
 
+// Bits of the PROP_TX_COMPONENT_ENABLE property.
+const (
+	// componentPilot enables the 19 kHz stereo pilot tone.
+	componentPilot = 1 << 0
+
+	// componentLMR enables the left minus right stereo channel.
+	componentLMR = 1 << 1
+
+	// componentRDS enables the RDS/RBDS subcarrier.
+	componentRDS = 1 << 2
+)
+
+// Bits of the PROP_TX_LINE_INPUT_MUTE property.
+const (
+	// lineInputMuteRight mutes the right line input.
+	lineInputMuteRight = 1 << 0
+
+	// lineInputMuteLeft mutes the left line input.
+	lineInputMuteLeft = 1 << 1
+)
+
+// Fields of the PROP_TX_RDS_PS_MISC property.
+const (
+	// psMiscBase sets RDSD0, FORCEB and RDSMS, which mark the station
+	// as stereo and music.
+	psMiscBase = 0x1808
+
+	// psMiscPTYShift is the offset of the 5 bits program type.
+	psMiscPTYShift = 5
+
+	// psMiscTA marks an ongoing traffic announcement.
+	psMiscTA = 1 << 4
+
+	// psMiscTP marks the station as carrying traffic announcements.
+	psMiscTP = 1 << 10
+)
+
+// Bits of the PROP_TX_ASQ_INTERRUPT_SOURCE property and of the
+// audio signal quality flags read via CMD_TX_ASQ_STATUS.
+const (
+	// asqLow signals that the input level was below the low threshold.
+	asqLow = 1 << 0
+
+	// asqHigh signals that the input level was above the high threshold.
+	asqHigh = 1 << 1
+
+	// asqOvermodulation signals that the transmitted signal is overmodulating.
+	asqOvermodulation = 1 << 2
+)
+
+const (
+	// rdsStationNameLength is the length of an RDS station name (PS).
+	rdsStationNameLength = 8
+
+	// rdsMaxStations is the number of RDS station names the device can hold.
+	rdsMaxStations = 12
+
+	// rdsRadioTextLength is the maximum length of the RadioText.
+	rdsRadioTextLength = 64
+)
+
 // Define the format for the command to send to the transmitter
 type command []uint8
 
 // The list of the different commands.
-func cmdPowerUp() command {
+func cmdPowerUp(opMode uint8) command {
 	return command{
 		CMD_POWER_UP,
 		0x12,
@@ -249,7 +345,7 @@ func cmdPowerUp() command {
 		// Boot normally
 		// Cristal oscillator Enabled
 		// FM transmit
-		0x50, // analog input mode
+		opMode, // analog or digital input mode
 	}
 }
 
@@ -283,13 +379,13 @@ func cmdReadTuneStatus() command {
 	}
 }
 
-func cmdTuneMeasure(h, l uint8) command {
+func cmdTuneMeasure(h, l, antCap uint8) command {
 	return command{
 		CMD_TX_TUNE_MEASURE,
 		0,
 		h,
 		l,
-		0,
+		antCap, // 0 is auto
 	}
 }
 
@@ -314,6 +410,15 @@ func cmdSetProperty() command {
 	}
 }
 
+func cmdGetProperty(h, l uint8) command {
+	return command{
+		CMD_GET_PROPERTY,
+		0,
+		h,
+		l,
+	}
+}
+
 func cmdSetRDSStationName(slotName uint8, n1, n2, n3, n4 byte) command {
 	return command{
 		CMD_TX_RDS_PS,
@@ -338,6 +443,19 @@ func cmdSetRDSMessage(messageType, msgType, msgP, slot uint8, n1 byte, n2 byte,
 	}
 }
 
+func cmdRDSGroup(flags uint8, b, c, d uint16) command {
+	return command{
+		CMD_TX_RDS_BUFF,
+		flags,
+		uint8(b >> 8),
+		uint8(b & 0xFF),
+		uint8(c >> 8),
+		uint8(c & 0xFF),
+		uint8(d >> 8),
+		uint8(d & 0xFF),
+	}
+}
+
 func cmdSetGPIOCtrl(pin uint8) command {
 	return command{
 		CMD_GPO_CTL,
@@ -359,43 +477,420 @@ func cmdASQStatus() command {
 	}
 }
 
+// AudioInput selects the audio interface used by the transmitter.
+type AudioInput uint8
+
+//goland:noinspection GoUnusedConst,GoUnnecessarilyExportedIdentifiers
+const (
+	// AudioInputAnalog uses the LIN/RIN analog line inputs.
+	AudioInputAnalog AudioInput = iota
+
+	// AudioInputDigital uses the DIN/DFS/DCLK digital audio interface.
+	AudioInputDigital
+)
+
+// Power up operation modes for each audio input.
+const (
+	opModeAnalog  = 0x50
+	opModeDigital = 0x0F
+)
+
+// Bounds of the audio and pilot settings, in Hz.
+const (
+	maxAudioDeviation = 90000
+	maxPilotDeviation = 90000
+	minPilotFrequency = 18000
+	maxPilotFrequency = 19000
+	maxRDSDeviation   = 7500
+)
+
+// maxResetPulse is the longest ResetPulse.
+const maxResetPulse = time.Second
+
+// maxSettleDelay is the longest SettleDelay.
+const maxSettleDelay = time.Second
+
+// maxAntennaCap is the highest antenna tuning capacitor value, 47.75 pF.
+const maxAntennaCap = 191
+
+// maxRDSPSRepeatCount is the highest PROP_TX_RDS_PS_REPEAT_COUNT value.
+const maxRDSPSRepeatCount = 255
+
+// lineInputAttenuations holds the maximum line input level, in mVPK,
+// of each line input attenuation setting.
+var lineInputAttenuations = [...]uint16{190, 301, 416, 636}
+
+// maxLineInputLevel is the maximum line input level, in mVPK.
+const maxLineInputLevel = 636
+
+// retryBackoff is the delay before the first retry of a command,
+// growing with each retry.
+const retryBackoff = 10 * time.Millisecond
+
+// ctsPollInterval is the delay between two reads of the status waiting for CTS.
+const ctsPollInterval = time.Millisecond
+
+const (
+	// fadeStep is the transmission power decrease for each fade-out step, in dBuV.
+	fadeStep = 3
+
+	// fadeStepDelay is the time between two fade-out steps.
+	fadeStepDelay = 25 * time.Millisecond
+)
+
+// PreEmphasis selects the pre-emphasis time constant of the transmission.
+// It must match what the receivers in the region expect.
+type PreEmphasis uint16
+
+//goland:noinspection GoUnusedConst,GoUnnecessarilyExportedIdentifiers
+const (
+	// PreEmphasis75us is used in the USA.
+	PreEmphasis75us PreEmphasis = iota
+
+	// PreEmphasis50us is used in Europe, Australia and Japan.
+	PreEmphasis50us
+
+	// PreEmphasisOff disables the pre-emphasis.
+	PreEmphasisOff
+)
+
+// RDSMix selects the share of the RDS groups used by the station names (PS),
+// the others being taken from the group buffer, e.g. for the RadioText.
+type RDSMix uint8
+
+//goland:noinspection GoUnusedConst,GoUnnecessarilyExportedIdentifiers
+const (
+	// RDSMixHalf sends the station names in 50% of the groups, the device default.
+	RDSMixHalf RDSMix = iota
+
+	// RDSMixWhenIdle sends the station names only when the group buffer is empty.
+	RDSMixWhenIdle
+
+	// RDSMixEighth sends the station names in 12.5% of the groups.
+	RDSMixEighth
+
+	// RDSMixQuarter sends the station names in 25% of the groups.
+	RDSMixQuarter
+
+	// RDSMixThreeQuarters sends the station names in 75% of the groups.
+	RDSMixThreeQuarters
+
+	// RDSMixSevenEighths sends the station names in 87.5% of the groups.
+	RDSMixSevenEighths
+
+	// RDSMixPSOnly sends the station names in all the groups.
+	RDSMixPSOnly
+)
+
+// rdsMixValues holds the PROP_TX_RDS_PS_MIX value of each RDSMix.
+var rdsMixValues = [...]uint16{
+	RDSMixHalf:          3,
+	RDSMixWhenIdle:      0,
+	RDSMixEighth:        1,
+	RDSMixQuarter:       2,
+	RDSMixThreeQuarters: 4,
+	RDSMixSevenEighths:  5,
+	RDSMixPSOnly:        6,
+}
+
+// Compressor configures the audio dynamic range control and the limiter.
+// See DefaultCompressor for the settings used when none are configured.
+type Compressor struct {
+	// Enable turns on the audio dynamic range control
+	Enable bool
+
+	// Limiter turns on the audio limiter
+	Limiter bool
+
+	// ThresholdDB is the threshold level for the dynamic range control.
+	// Must be between -40 and 0 dBFS.
+	ThresholdDB int8
+
+	// AttackTime is the attack time for the dynamic range control.
+	// Must be between 0 (0.5 ms) and 9 (5 ms), in 0.5 ms steps.
+	AttackTime uint8
+
+	// ReleaseTime is the release time for the dynamic range control.
+	// Must be between 0 and 4, for 100, 200, 350, 525 and 1000 ms.
+	ReleaseTime uint8
+
+	// GainDB is the gain of the dynamic range control.
+	// Must be between 0 and 20 dB.
+	GainDB uint8
+
+	// LimiterReleaseTime is the limiter release time.
+	// Must be between 5 (102.4 ms) and 2000 (0.25 ms). 102 is 5.01 ms.
+	LimiterReleaseTime uint16
+}
+
+// DefaultCompressor returns the compressor settings used when none are
+// configured: the limiter turned on with a 10 dB gain and the chip
+// defaults for everything else.
+func DefaultCompressor() Compressor {
+	return Compressor{
+		Enable:             false,
+		Limiter:            true,
+		ThresholdDB:        -40,
+		AttackTime:         0,
+		ReleaseTime:        4,
+		GainDB:             10,
+		LimiterReleaseTime: 102,
+	}
+}
+
+// validate checks that all the compressor settings are in bounds.
+func (c Compressor) validate() error {
+	if c.ThresholdDB < -40 || c.ThresholdDB > 0 {
+		return fmt.Errorf("compressor threshold %d not in -40 ... 0 dBFS bounds", c.ThresholdDB)
+	}
+	if c.AttackTime > 9 {
+		return fmt.Errorf("compressor attack time %d not in 0 ... 9 bounds", c.AttackTime)
+	}
+	if c.ReleaseTime > 4 {
+		return fmt.Errorf("compressor release time %d not in 0 ... 4 bounds", c.ReleaseTime)
+	}
+	if c.GainDB > 20 {
+		return fmt.Errorf("compressor gain %d not in 0 ... 20 dB bounds", c.GainDB)
+	}
+	if c.LimiterReleaseTime < 5 || c.LimiterReleaseTime > 2000 {
+		return fmt.Errorf("limiter release time %d not in 5 ... 2000 bounds", c.LimiterReleaseTime)
+	}
+	return nil
+}
+
+// enableFlags computes the PROP_TX_ACOMP_ENABLE value.
+func (c Compressor) enableFlags() uint16 {
+	var res uint16
+	if c.Enable {
+		res |= 1 << 0
+	}
+	if c.Limiter {
+		res |= 1 << 1
+	}
+	return res
+}
+
 // Si4713Config holds the additional configuration needed for Si4713Driver.
 type Si4713Config struct {
+	// CommandTimeout is how long to wait for the device to accept a command,
+	// signaled by the CTS bit. Default is 100ms.
+	CommandTimeout time.Duration
+
+	// Compressor configures the audio dynamic range control and the limiter.
+	// When nil, DefaultCompressor is used.
+	Compressor *Compressor
+
 	// DebugMode allows for greater details to be available during debugging
 	DebugMode bool
 
-	// DebugLog allows for debugging message handling
-	DebugLog func(format string, v ...interface{})
+	// DebugLog allows for debugging message handling.
+	// Required with DebugMode, unless a Logger is configured.
+	DebugLog func(format string, v ...interface{}) `json:"-"`
+
+	// LineInputLevelMV is the peak line input level, in mVPK, which reaches the
+	// maximum audio deviation. Must be between 1 and 636. Default is 636.
+	LineInputLevelMV uint16
+
+	// Log provides access to any log data produced by the device.
+	// The messages are discarded when nil.
+	Log func(format string, v ...interface{}) `json:"-"`
 
-	// Log provides access to any log data produced by the device
-	Log func(format string, v ...interface{})
+	// Logger receives all the log messages produced by the device.
+	// When nil, the messages are sent to Log and DebugLog.
+	Logger Logger `json:"-"`
 
-	// AlternateFrequency specifies transmission frequency.
-	// Must be between 8750 and 10800.
+	// AlternateFrequency is the RDS alternate frequency announced to the receivers.
+	// Must be between 8760 and 10790, in 100 kHz steps. Default is 0, none.
 	// Value * 10 = value in MHz
 	AlternateFrequency uint16
 
+	// AntennaCap is the antenna tuning capacitor, in 0.25 pF steps.
+	// Must be at most 191. Default is 0, tuned automatically.
+	AntennaCap uint8
+
+	// AudioDeviationHz is the audio frequency deviation in Hz.
+	// Must be at most 90000. Default is 66250.
+	AudioDeviationHz uint32
+
+	// AudioInput selects the analog or the digital audio input. Default is analog.
+	AudioInput AudioInput
+
+	// CallSign is the North American call sign of the station, e.g. "KABC".
+	// When set, RDSProgramID is derived from it.
+	// Requires Region to be RegionNorthAmerica.
+	CallSign string
+
+	// ChannelSpacing is the spacing of the FM channels from 87.50 MHz, in 10 kHz
+	// units, e.g. 10 for the 100 kHz European grid or 20 for the 200 kHz
+	// American one. A TransmitFrequency off the grid, which can interfere with
+	// the adjacent channels, is reported by Validate, see SnapToChannel.
+	// Default is 0, no check.
+	ChannelSpacing uint16
+
+	// DisableAFC turns off the automatic frequency control by
+	// setting the reference clock frequency to 0.
+	DisableAFC bool
+
+	// DigitalFormat is the PROP_DIGITAL_INPUT_FORMAT value used with the digital input.
+	// Bits 1:0 select the sample size (16, 20, 24, 8 bits), bit 2 mono audio,
+	// bits 6:3 the mode (0 for I2S, 7 for left-justified, 13 for DSP mode)
+	// and bit 7 sampling on the falling DCLK edge. Default is 0, 16 bits I2S stereo.
+	DigitalFormat uint16
+
+	// DigitalSampleRate is the sample rate of the digital input in Hz.
+	// Must be between 32000 and 48000. Default is 48000.
+	DigitalSampleRate uint16
+
+	// FadeOnHalt ramps the transmission power down to the minimum
+	// before powering down the device on Halt, avoiding an audible pop
+	FadeOnHalt bool
+
 	// HasRDS enables the RDS support
 	HasRDS bool
 
-	// RDSProgramID specifies the ID of our station for RDS transmission
+	// MaxRetries is the number of times a command is sent again after an i2c error.
+	// Timeouts are not retried, nor are the power up and the RDS group loads,
+	// which the device may have taken before the error. Default is 0, no retries.
+	MaxRetries uint8
+
+	// Mono disables the stereo pilot and L-R channel, transmitting
+	// only the L+R audio. RDS is unaffected.
+	Mono bool
+
+	// Name identifies the device in the gobot logs and API, e.g. "kitchen".
+	// Default is a gobot.DefaultName, "Si4713Driver-" and a random suffix.
+	Name string
+
+	// OvermodulationDurationMs is how long, in milliseconds, the input audio must
+	// stay above OvermodulationThresholdDBFS to be considered too hot. Default is 50.
+	OvermodulationDurationMs uint16
+
+	// OvermodulationThresholdDBFS is the input audio level over which the audio
+	// is considered too hot. Must be between -70 and 0. Default is -10 dBFS.
+	OvermodulationThresholdDBFS int8
+
+	// PilotDeviationHz is the pilot tone frequency deviation in Hz.
+	// Must be at most 90000. Default is 6750.
+	PilotDeviationHz uint32
+
+	// PilotFrequencyHz is the frequency of the stereo pilot in Hz.
+	// Must be between 18000 and 19000. Default is 19000.
+	PilotFrequencyHz uint16
+
+	// PreEmphasis sets the pre-emphasis time constant. Default is 75 μS.
+	PreEmphasis PreEmphasis
+
+	// OnMeasurement is called by ScanBand, and the scan of WithFrequencyScan,
+	// with each noise measurement as soon as it is read, e.g. to update a live
+	// display. It runs with the driver locked, so it must not use the driver.
+	OnMeasurement func(FrequencyNoise) `json:"-"`
+
+	// OnOvermodulation is called from Loop when the transmission overmodulates
+	// or the input audio level stayed above OvermodulationThresholdDBFS for
+	// OvermodulationDurationMs. Setting it enables overmodulation detection.
+	OnOvermodulation func() `json:"-"`
+
+	// OnRDSOverflow is called from Loop and the RDS pump when the FIFO has
+	// no room left for the clock-time or the RadioText groups, i.e. when the
+	// RDS groups are loaded faster than they are transmitted.
+	// The groups are loaded again on the next Loop or pump check.
+	OnRDSOverflow func() `json:"-"`
+
+	// OnSilence is called from Loop when the input audio level stayed below
+	// SilenceThresholdDBFS for SilenceDurationMs. Setting it enables silence detection.
+	OnSilence func() `json:"-"`
+
+	// ProgramType is the RDS program type (PTY) code, between 0 and 31.
+	// It lets receivers show the genre of the station, e.g. "News" or "Rock".
+	ProgramType uint8
+
+	// RDSProgramID specifies the ID of our station for RDS transmission.
+	// The 0x0000 code is reserved, it is replaced by DefaultRDSProgramID
+	// unless RequireRDSProgramID is set.
 	RDSProgramID uint16
 
+	// RequireRDSProgramID makes Validate fail when HasRDS is set
+	// without an RDSProgramID, instead of using DefaultRDSProgramID.
+	RequireRDSProgramID bool
+
+	// RDSDeviationHz is the RDS frequency deviation in Hz.
+	// Must be at most 7500. Default is 2000.
+	RDSDeviationHz uint16
+
 	// RDSMessage is the message sent out via RDS
 	RDSMessage string
 
+	// RDSMixRatio is the share of the RDS groups used by the station names.
+	// Default is RDSMixHalf.
+	RDSMixRatio RDSMix
+
+	// RDSPSRepeatCount is the number of times each station name is repeated
+	// before showing the next one. Must be between 1 and 255. Default is 3.
+	RDSPSRepeatCount uint16
+
+	// RefClkFreq is the frequency of the reference clock in Hz, after the prescaler.
+	// Must be between 31130 and 34406. Default is 32768.
+	RefClkFreq uint16
+
+	// RefClkPrescale is the PROP_REFCLK_PRESCALE value. Bits 11:0 hold the
+	// prescaler, between 1 and 4095, and bit 12 selects the DCLK pin as the
+	// clock source instead of RCLK. Default is 1.
+	RefClkPrescale uint16
+
+	// Region selects RDS or RBDS conventions. Default is RegionEurope.
+	Region Region
+
 	// ResetPin marks the pin used for resetting the device. Default is 29
 	ResetPin string
 
+	// ResetPulse is the time between the reset pin toggles.
+	// Must be at most 1 second. Default is 10 ms.
+	ResetPulse time.Duration
+
 	// RDSStationName is the name of the station that shows up in RDS information
 	RDSStationName string
 
+	// SettleDelay is the time waited by Start between setting the transmission
+	// power and tuning the frequency. Some boards need it to settle after the
+	// power-up, else the first tune reports a stale status.
+	// Must be at most 1 second. Default is 0, no delay.
+	SettleDelay time.Duration
+
+	// SilenceDurationMs is how long, in milliseconds, the input audio must stay
+	// below SilenceThresholdDBFS to be considered silence. Default is 10000.
+	SilenceDurationMs uint16
+
+	// SilenceThresholdDBFS is the input audio level under which the audio
+	// is considered silent. Must be between -70 and 0. Default is -50 dBFS.
+	SilenceThresholdDBFS int8
+
+	// Simulate replaces the device with an in-memory one, e.g. to run without
+	// the hardware. The i2c connector is not used and can be nil.
+	// See SimulatedState.
+	Simulate bool
+
+	// SnapToChannel moves a TransmitFrequency off the ChannelSpacing grid
+	// to the closest channel, instead of only logging a warning.
+	SnapToChannel bool
+
 	// StopAfterFrequencyScan enables us exit after a quick frequency scan.
 	// Must be combined with WithFrequencyScan flag.
 	StopAfterFrequencyScan bool
 
+	// TrafficAnnouncement signals that a traffic announcement is on air.
+	// Use SetTrafficAnnouncement to toggle it during the transmission.
+	TrafficAnnouncement bool
+
+	// TrafficProgram signals that the station carries traffic announcements.
+	TrafficProgram bool
+
+	// TuneTimeout is how long to wait for a tune or a noise measurement to complete.
+	// Default is 500ms.
+	TuneTimeout time.Duration
+
 	// TransmitFrequency is our main transmission frequency.
-	// Must be between 8750 and 10800.
+	// Must be between 8750 and 10800. When WithFrequencyScan is set, it can be
+	// left empty so that the clearest frequency of the band is picked.
 	// Value * 10 = value in MHz
 	TransmitFrequency uint16
 
@@ -403,6 +898,15 @@ type Si4713Config struct {
 	// Must be between 88-115, value is in dBuV
 	TransmitPower uint8
 
+	// TruncateRDSText cuts the RDS texts which are too long, e.g. an
+	// RDSStationName over 8 characters or an RDSMessage over 64, logging
+	// a warning. By default, these texts are rejected with an error.
+	TruncateRDSText bool
+
+	// UseAlternateAddress selects the AlternativeAddress, used when SEN is low,
+	// instead of the default Address
+	UseAlternateAddress bool
+
 	// WithFrequencyScan enables scanning of frequencies before transmission.
 	// Can be used with StopAfterFrequencyScan.
 	WithFrequencyScan bool
@@ -410,16 +914,44 @@ type Si4713Config struct {
 
 // Si4713Driver holds the implementation to talk to the
 // Adafruit Si 4713 FM Radio Transmitter breakout.
-//
-//goland:noinspection GoUnnecessarilyExportedIdentifiers
+// It is safe for concurrent use: each method runs its i2c transactions
+// without interleaving with the other methods.
 type Si4713Driver struct {
 	name         string
 	i2cAddr      int
 	conn         i2c.Connection
 	i2cConnector i2c.Connector
 	i2c.Config
+	gobot.Commander
+	gobot.Eventer
 
 	Si4713Config
+
+	// mtx serializes the i2c transactions
+	mtx sync.Mutex
+
+	// clockTimeSent is the minute of the last RDS clock-time transmission
+	clockTimeSent time.Time
+
+	// gpoLevels and gpoOutputs are the last CMD_GPO_SET and CMD_GPO_CTL masks
+	gpoLevels  uint8
+	gpoOutputs uint8
+
+	// sleepFunc waits between the device operations, see WithSleep
+	sleepFunc func(ctx context.Context, d time.Duration) error
+
+	// radioText is the last RadioText sent and radioTextB its A/B flag
+	radioText  string
+	radioTextB bool
+
+	// afWords is the encoded alternate frequencies list, rotated through
+	// PROP_TX_RDS_PS_AF from afIndex, or nil for AlternateFrequency
+	afWords []uint16
+	afIndex int
+
+	// textGroups are the blocks B, C and D of the RadioText groups last
+	// loaded in the circular buffer, used to refill the FIFO
+	textGroups [][3]uint16
 }
 
 // Name of our device.
@@ -434,53 +966,69 @@ func (s *Si4713Driver) SetName(name string) {
 
 // Start the device work.
 func (s *Si4713Driver) Start() error {
+	return s.StartContext(context.Background())
+}
+
+// StartContext works like Start but stops as soon as the context is done,
+// returning the context error. The context bounds the reset delays, the
+// frequency scans and the waits for the device.
+func (s *Si4713Driver) StartContext(ctx context.Context) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
 	// Run validation again, just in case the driver was not created
 	// via the New function
 	if err := s.Validate(); err != nil {
 		return err
 	}
 
-	bus := s.GetBusOrDefault(s.i2cConnector.GetDefaultBus())
-
-	if conn, err := s.i2cConnector.GetConnection(s.i2cAddr, bus); err != nil {
-		return err
-	} else {
-		s.conn = conn
-	}
-
-	if begun, err := s.begin(); err != nil {
+	if err := s.connect(ctx); err != nil {
 		return err
-	} else if !begun { // begin with address 0x63 (CS high default)
-		return fmt.Errorf("couldn't find radio")
 	}
 
+	var noise []FrequencyNoise
 	if s.WithFrequencyScan {
-		if err := s.scanFrequencies(); err != nil {
+		var err error
+		if noise, err = s.scanFrequencies(ctx); err != nil {
 			return err
 		}
 	}
 
 	if s.StopAfterFrequencyScan {
-		return fmt.Errorf("forced stop due to configuration option")
+		return ErrStoppedAfterScan
+	}
+
+	if s.WithFrequencyScan && s.TransmitFrequency == 0 {
+		s.TransmitFrequency = clearestFrequency(noise).FrequencyKHz
 	}
 
 	if s.WithFrequencyScan {
-		if err := s.scanTransmitFrequency(); err != nil {
+		if err := s.scanTransmitFrequency(ctx); err != nil {
 			return err
 		}
 	}
 
+	if err := s.configureAudio(); err != nil {
+		return err
+	}
+
 	if s.DebugMode {
-		s.DebugLog("Set TX power %d\n", s.TransmitPower)
+		s.Logger.Debugf("Set TX power %d\n", s.TransmitPower)
 	}
-	if err := s.setTxPower(s.TransmitPower, 0); err != nil {
+	if err := s.setTxPower(s.TransmitPower, s.AntennaCap); err != nil {
 		return err
 	}
 
+	if s.SettleDelay > 0 {
+		if err := s.sleep(ctx, s.SettleDelay); err != nil {
+			return err
+		}
+	}
+
 	if s.DebugMode {
-		s.DebugLog("Tuning into %.2f\n", float32(s.TransmitFrequency)/100)
+		s.Logger.Debugf("Tuning into %.2f\n", float32(s.TransmitFrequency)/100)
 	}
-	if err := s.tuneFM(s.TransmitFrequency); err != nil {
+	if err := s.tuneFM(ctx, s.TransmitFrequency); err != nil {
 		return err
 	}
 
@@ -488,27 +1036,110 @@ func (s *Si4713Driver) Start() error {
 	if currFreq, currdBuV, currAntCap, currNoiseLevel, err := s.readTuneStatus(); err != nil {
 		return err
 	} else if s.DebugMode {
-		s.DebugLog("Curr freq: %.2f\n", float32(currFreq)/100)
-		s.DebugLog("Curr freq dBuV: %d\n", currdBuV)
-		s.DebugLog("Curr ANT cap: %d\n", currAntCap)
-		s.DebugLog("Curr noise level: %d\n", currNoiseLevel)
+		s.Logger.Debugf("Curr freq: %.2f\n", float32(currFreq)/100)
+		s.Logger.Debugf("Curr freq dBuV: %d\n", currdBuV)
+		s.Logger.Debugf("Curr ANT cap: %d\n", currAntCap)
+		s.Logger.Debugf("Curr noise level: %d\n", currNoiseLevel)
 	}
 
 	if s.HasRDS {
-		if err := s.EnableRDS(); err != nil {
+		if err := s.enableRDS(); err != nil {
+			return err
+		}
+	}
+
+	if s.Mono {
+		if err := s.setProperty(PROP_TX_COMPONENT_ENABLE, s.components()); err != nil {
 			return err
 		}
 	}
 
+	if err := s.configureASQ(); err != nil {
+		return err
+	}
+
 	// set GP1 and GP2 to output
-	return s.setGPIOCtrl(1<<1 | 1<<2)
+	return s.setGPIOCtrl(gpoMask(1) | gpoMask(2))
+}
+
+// ScanOnly powers up the device and measures the noise level over the FM band,
+// like Start with WithFrequencyScan and StopAfterFrequencyScan does, but
+// returns the results. The device doesn't transmit, use Halt to power it down.
+func (s *Si4713Driver) ScanOnly() ([]FrequencyNoise, error) {
+	return s.ScanOnlyContext(context.Background())
+}
+
+// ScanOnlyContext works like ScanOnly but stops as soon as the context is done,
+// returning the context error.
+func (s *Si4713Driver) ScanOnlyContext(ctx context.Context) ([]FrequencyNoise, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+	return s.scanBand(ctx, 0, 0, 0)
+}
+
+// connect opens the i2c connection, or the simulated one, then powers up the device.
+func (s *Si4713Driver) connect(ctx context.Context) error {
+	if s.Simulate {
+		s.conn = &simulatedDevice{}
+	} else {
+		bus := s.GetBusOrDefault(s.i2cConnector.GetDefaultBus())
+
+		if conn, err := s.i2cConnector.GetConnection(s.i2cAddr, bus); err != nil {
+			return err
+		} else {
+			s.conn = conn
+		}
+	}
+
+	if begun, err := s.begin(ctx); err != nil {
+		return err
+	} else if !begun { // begin with address 0x63 (CS high default)
+		return ErrRadioNotFound
+	}
+	return nil
 }
 
 // Halt stops the device in a graceful way.
+// The RDS transmission is stopped first and, with FadeOnHalt, the transmission
+// power is ramped down before powering down the device.
 func (s *Si4713Driver) Halt() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.HasRDS {
+		if err := s.disableRDS(); err != nil {
+			return err
+		}
+	}
+
+	if s.FadeOnHalt {
+		if err := s.fadeOut(); err != nil {
+			return err
+		}
+	}
 	return s.powerDown()
 }
 
+// Lowers the transmission power in steps, down to the minimum of 88 dBuV.
+func (s *Si4713Driver) fadeOut() error {
+	for pwr := int(s.TransmitPower) - fadeStep; pwr > 88; pwr -= fadeStep {
+		if err := s.setTxPower(uint8(pwr), s.AntennaCap); err != nil {
+			return err
+		}
+		_ = s.sleep(context.Background(), fadeStepDelay)
+	}
+
+	return s.setTxPower(88, s.AntennaCap)
+}
+
 // Connection retrieves the i2c connection to the device.
 func (s *Si4713Driver) Connection() gobot.Connection {
 	return s.i2cConnector.(gobot.Connection)
@@ -516,254 +1147,1259 @@ func (s *Si4713Driver) Connection() gobot.Connection {
 
 // EnableRDS will configure then turn on the RDS/RDBS transmission.
 func (s *Si4713Driver) EnableRDS() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.enableRDS()
+}
+
+func (s *Si4713Driver) enableRDS() error {
 	if err := s.beginRDS(s.RDSProgramID); err != nil {
 		return err
 	}
-	if err := s.SetRDSStation(s.RDSStationName); err != nil {
+	if err := s.setRDSStation(s.RDSStationName); err != nil {
 		return err
 	}
-	if err := s.SetRDSMessage(s.RDSMessage); err != nil {
+	if err := s.setRDSMessage(s.RDSMessage); err != nil {
 		return err
 	}
 
 	if s.DebugMode {
-		s.DebugLog("RDS on!\n")
+		s.Logger.Debugf("RDS on!\n")
 	}
 
 	return nil
 }
 
-// Scan transmission power of entire range from 87.5 to 108.0 MHz.
-func (s *Si4713Driver) scanFrequencies() error {
-	for f := uint16(7600); f < 10800; f += 10 {
-		if err := s.readTuneMeasure(f); err != nil {
-			return err
-		}
-
-		_, _, _, currNoiseLevel, err := s.readTuneStatus()
-		if err != nil {
-			return err
-		}
-		if s.DebugMode {
-			s.DebugLog("Noise level on %.2f MHz is %d\n", float32(f)/100, currNoiseLevel)
-		}
-	}
-	return nil
+// DisableRDS turns off the RDS/RDBS transmission and empties the RDS group
+// buffer and FIFO, so no stale text is sent when RDS is enabled again.
+func (s *Si4713Driver) DisableRDS() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.disableRDS()
 }
 
-// Scan the power of existing transmissions over our transmission frequency.
-func (s *Si4713Driver) scanTransmitFrequency() error {
-	if err := s.readTuneMeasure(s.TransmitFrequency); err != nil {
+func (s *Si4713Driver) disableRDS() error {
+	if err := s.setProperty(PROP_TX_COMPONENT_ENABLE, s.components()&^componentRDS); err != nil {
 		return err
 	}
 
-	_, _, _, currNoiseLevel, err := s.readTuneStatus()
-	if err != nil {
+	if err := s.sendCommand(cmdRDSGroup(rdsBuffEmpty|rdsBuffIntAck, 0, 0, 0)); err != nil {
 		return err
 	}
-	if s.DebugMode {
-		s.DebugLog("Noise level on %.2f MHz is %d\n", float32(s.TransmitFrequency)/100, currNoiseLevel)
+	if err := s.sendCommand(cmdRDSGroup(rdsBuffFIFO|rdsBuffEmpty, 0, 0, 0)); err != nil {
+		return err
 	}
+
+	s.radioText = ""
+	s.radioTextB = false
+	s.textGroups = nil
 	return nil
 }
 
-// SetGPIO controls the GPIO pins on the device
-// You can toggle both off by sending 1<<0, or both.
-//
-//goland:noinspection GoUnnecessarilyExportedIdentifiers
-func (s *Si4713Driver) SetGPIO(pin uint8) error {
-	return s.sendCommand(cmdSetGPIO(pin))
+// MeasureNoise measures the received noise level, in dBuV, on the frequency.
+// The frequency must be between 7600 and 10800, it is rounded down to the
+// 50 kHz steps the device measures.
+func (s *Si4713Driver) MeasureNoise(freqKHz uint16) (uint8, error) {
+	return s.MeasureNoiseWithAntennaCap(freqKHz, 0)
 }
 
-// readASQ performs a status read for the TxAsqStatus.
-func (s *Si4713Driver) readASQ() (status, currASQ, currInLevel byte, err error) {
-	if err = s.sendCommand(cmdASQStatus()); err != nil {
-		return 0, 0, 0, err
+// MeasureNoiseWithAntennaCap measures the received noise level like MeasureNoise,
+// using the antenna tuning capacitor between 1 and 191 instead of letting the
+// device pick it, e.g. for a fixed antenna. 0 selects the automatic tuning.
+func (s *Si4713Driver) MeasureNoiseWithAntennaCap(freqKHz uint16, antCap uint8) (uint8, error) {
+	if freqKHz < 7600 || freqKHz > 10800 {
+		return 0, fmt.Errorf("measured frequency %d not in 7600 ... 10800 bounds", freqKHz)
+	}
+	if antCap > maxAntennaCap {
+		return 0, fmt.Errorf("antenna capacitor %d not in 0 ... %d bounds", antCap, maxAntennaCap)
 	}
 
-	values, err := s.buffRead(5)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := s.readTuneMeasure(context.Background(), freqKHz, antCap); err != nil {
+		return 0, err
+	}
+
+	status, err := s.tuneStatus()
 	if err != nil {
-		return 0, 0, 0, err
+		return 0, err
 	}
+	return status.NoiseLevel, nil
+}
 
-	status = values[0]
-	currASQ = values[1]
+// FrequencyNoise holds the noise level measured on a frequency.
+type FrequencyNoise struct {
+	// FrequencyKHz is the measured frequency.
+	// Value * 10 = value in MHz
+	FrequencyKHz uint16
 
-	// discard
-	_, _ = values[2], values[3]
+	// NoiseLevel is the received noise level in dBuV
+	NoiseLevel uint8
+}
 
-	currInLevel = values[4]
+// ScanBand measures the received noise level from start to end, both included,
+// in steps. All are in 10 kHz units and 0 selects the default: the FM band from
+// 8750 to 10800, in 100 kHz steps of 10.
+// The results can be used to pick a clear channel for the transmission.
+// Set OnMeasurement to follow the scan progress.
+func (s *Si4713Driver) ScanBand(start, end, step uint16) ([]FrequencyNoise, error) {
+	return s.ScanBandContext(context.Background(), start, end, step)
+}
 
-	return status, currASQ, currInLevel, nil
+// ScanBandContext works like ScanBand but stops as soon as the context is done,
+// returning the context error.
+func (s *Si4713Driver) ScanBandContext(ctx context.Context, start, end, step uint16) ([]FrequencyNoise, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.scanBand(ctx, start, end, step)
 }
 
-// Queries the status of a previously sent TX Tune Freq, TX Tune
-// Power, or TX Tune Measure using CMD_TX_TUNE_STATUS command.
-func (s *Si4713Driver) readTuneStatus() (currFreq uint16, currdBuV, currAntCap, currNoiseLevel uint8, err error) {
-	if err = s.sendCommand(cmdReadTuneStatus()); err != nil {
-		return 0, 0, 0, 0, err
+func (s *Si4713Driver) scanBand(ctx context.Context, start, end, step uint16) ([]FrequencyNoise, error) {
+	if start == 0 {
+		start = 8750
 	}
-
-	// status and resp1
-	if _, err = s.conn.ReadByte(); err != nil {
-		return 0, 0, 0, 0, err
+	if end == 0 {
+		end = 10800
 	}
-	if _, err = s.conn.ReadByte(); err != nil {
-		return 0, 0, 0, 0, err
+	if step == 0 {
+		step = 10
 	}
+	if start < 8750 || end > 10800 {
+		return nil, fmt.Errorf("scan band %d ... %d: %w", start, end, ErrFrequencyOutOfRange)
+	}
+	if start > end {
+		return nil, fmt.Errorf("scan band start %d after the end %d", start, end)
+	}
+
+	var res []FrequencyNoise
+	// uint32 so that the last step can't overflow
+	for freq := uint32(start); freq <= uint32(end); freq += uint32(step) {
+		f := uint16(freq)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if err := s.readTuneMeasure(ctx, f, 0); err != nil {
+			return nil, err
+		}
+
+		_, _, _, currNoiseLevel, err := s.readTuneStatus()
+		if err != nil {
+			return nil, err
+		}
+		measure := FrequencyNoise{FrequencyKHz: f, NoiseLevel: currNoiseLevel}
+		if s.OnMeasurement != nil {
+			s.OnMeasurement(measure)
+		}
+		res = append(res, measure)
+	}
+	return res, nil
+}
+
+// FindClearestFrequency measures the noise level on each of the candidate
+// frequencies and returns the one with the lowest noise.
+// When several candidates are equally clear, the lowest frequency wins.
+func (s *Si4713Driver) FindClearestFrequency(candidates []uint16) (uint16, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.findClearestFrequency(context.Background(), candidates)
+}
+
+func (s *Si4713Driver) findClearestFrequency(ctx context.Context, candidates []uint16) (uint16, error) {
+	if len(candidates) == 0 {
+		return 0, fmt.Errorf("no candidate frequencies to measure")
+	}
+
+	noise := make([]FrequencyNoise, 0, len(candidates))
+	for _, f := range candidates {
+		if f < 8750 || f > 10800 {
+			return 0, fmt.Errorf("candidate frequency %d: %w", f, ErrFrequencyOutOfRange)
+		}
+
+		if err := s.readTuneMeasure(ctx, f, 0); err != nil {
+			return 0, err
+		}
+		_, _, _, currNoiseLevel, err := s.readTuneStatus()
+		if err != nil {
+			return 0, err
+		}
+		if s.DebugMode {
+			s.Logger.Debugf("Noise level on %.2f MHz is %d\n", float32(f)/100, currNoiseLevel)
+		}
+
+		noise = append(noise, FrequencyNoise{FrequencyKHz: f, NoiseLevel: currNoiseLevel})
+	}
+
+	return clearestFrequency(noise).FrequencyKHz, nil
+}
+
+// clearestFrequency returns the measurement with the lowest noise,
+// the lowest frequency winning the ties. The noise must not be empty.
+func clearestFrequency(noise []FrequencyNoise) FrequencyNoise {
+	best := noise[0]
+	for _, n := range noise[1:] {
+		if n.NoiseLevel < best.NoiseLevel ||
+			n.NoiseLevel == best.NoiseLevel && n.FrequencyKHz < best.FrequencyKHz {
+			best = n
+		}
+	}
+	return best
+}
+
+// No alternate frequency, the PROP_TX_RDS_PS_AF default, and the
+// prefix of a single alternate frequency code, RDS AF method A.
+const (
+	rdsNoAF     = 0xE0E0
+	rdsSingleAF = 0xE100
+)
+
+// rdsMaxAlternateFrequencies is the longest alternate frequencies list of RDS.
+const rdsMaxAlternateFrequencies = 25
+
+// rdsFillerAF completes the last pair of an odd alternate frequencies list.
+const rdsFillerAF = 0xCD
+
+// validAlternateFrequency tells if the frequency has an RDS AF code,
+// 87.60 MHz to 107.90 MHz in 100 kHz steps.
+func validAlternateFrequency(freq uint16) bool {
+	return freq >= 8760 && freq <= 10790 && freq%10 == 0
+}
+
+// alternateFrequencyCode encodes the frequency for PROP_TX_RDS_PS_AF:
+// the count of one frequency, 0xE1, then the code of the frequency,
+// 1 for 87.60 MHz up to 204 for 107.90 MHz. 0 encodes no frequency.
+func alternateFrequencyCode(freq uint16) uint16 {
+	if freq == 0 {
+		return rdsNoAF
+	}
+	return rdsSingleAF | (freq-8750)/10
+}
+
+// alternateFrequencyList encodes the frequencies as RDS AF method A pairs:
+// the count of frequencies, from 0xE1, with the first frequency code,
+// then two frequency codes per pair.
+func alternateFrequencyList(freqs []uint16) []uint16 {
+	code := func(freq uint16) uint16 {
+		return (freq - 8750) / 10
+	}
+
+	res := []uint16{uint16(0xE0+len(freqs))<<8 | code(freqs[0])}
+	for i := 1; i < len(freqs); i += 2 {
+		word := code(freqs[i]) << 8
+		if i+1 < len(freqs) {
+			word |= code(freqs[i+1])
+		} else {
+			word |= rdsFillerAF
+		}
+		res = append(res, word)
+	}
+	return res
+}
+
+// SetAlternateFrequencies announces up to 25 alternate frequencies to the RDS
+// receivers, each between 8760 and 10790 in 100 kHz steps.
+// An empty list stops announcing alternate frequencies.
+//
+// The device repeats a single pair of AF codes, PROP_TX_RDS_PS_AF, in all its
+// 0A groups, so only one pair of the list is sent at a time: the count with
+// the first frequency, then the next two frequencies on each Loop call.
+// For n frequencies, the whole list takes n/2+1 Loop calls, e.g. 3 seconds
+// for 4 frequencies with a Loop each second. The pairs don't follow the 0A
+// groups as in an AF method A sequence, so the receivers may need several
+// rounds to collect the list.
+func (s *Si4713Driver) SetAlternateFrequencies(freqs []uint16) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if len(freqs) > rdsMaxAlternateFrequencies {
+		return fmt.Errorf("alternate frequencies count %d not in 0 ... %d bounds", len(freqs), rdsMaxAlternateFrequencies)
+	}
+	for _, f := range freqs {
+		if !validAlternateFrequency(f) {
+			return fmt.Errorf("alternate frequency %d not in 8760 ... 10790 bounds, in 100 kHz steps", f)
+		}
+	}
+
+	words := []uint16{rdsNoAF}
+	if len(freqs) > 0 {
+		words = alternateFrequencyList(freqs)
+	}
+	if err := s.setProperty(PROP_TX_RDS_PS_AF, words[0]); err != nil {
+		return err
+	}
+
+	s.AlternateFrequency = 0
+	if len(freqs) > 0 {
+		s.AlternateFrequency = freqs[0]
+	}
+	s.afWords = words
+	s.afIndex = 0
+	return nil
+}
+
+// rotateAlternateFrequencies sends the next pair of the alternate frequencies list.
+// It is called on each Loop, at the Loop rate rather than the 0A groups one.
+func (s *Si4713Driver) rotateAlternateFrequencies() error {
+	if len(s.afWords) < 2 {
+		return nil
+	}
+
+	idx := (s.afIndex + 1) % len(s.afWords)
+	if err := s.setProperty(PROP_TX_RDS_PS_AF, s.afWords[idx]); err != nil {
+		return err
+	}
+	s.afIndex = idx
+	return nil
+}
+
+// snapToChannel returns the channel closest to the frequency, on the grid
+// of the spacing from 87.50 MHz, staying in the FM band.
+func snapToChannel(freq, spacing uint16) uint16 {
+	off := (freq - 8750) % spacing
+	if off == 0 {
+		return freq
+	}
+	if off*2 >= spacing && freq-off+spacing <= 10800 {
+		return freq - off + spacing
+	}
+	return freq - off
+}
+
+// Scan transmission power of entire range from 87.5 to 108.0 MHz.
+func (s *Si4713Driver) scanFrequencies(ctx context.Context) ([]FrequencyNoise, error) {
+	noise, err := s.scanBand(ctx, 0, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.DebugMode {
+		for _, n := range noise {
+			s.Logger.Debugf("Noise level on %.2f MHz is %d\n", float32(n.FrequencyKHz)/100, n.NoiseLevel)
+		}
+	}
+	return noise, nil
+}
+
+// Scan the power of existing transmissions over our transmission frequency.
+func (s *Si4713Driver) scanTransmitFrequency(ctx context.Context) error {
+	if err := s.readTuneMeasure(ctx, s.TransmitFrequency, 0); err != nil {
+		return err
+	}
+
+	_, _, _, currNoiseLevel, err := s.readTuneStatus()
+	if err != nil {
+		return err
+	}
+	if s.DebugMode {
+		s.Logger.Debugf("Noise level on %.2f MHz is %d\n", float32(s.TransmitFrequency)/100, currNoiseLevel)
+	}
+	return nil
+}
+
+// SetGPIO controls the GPIO pins on the device
+// You can toggle both off by sending 1<<0, or both.
+func (s *Si4713Driver) SetGPIO(pin uint8) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.setGPIO(pin)
+}
+
+// SetGPO drives GPO1, GPO2 or GPO3 (pin 1 to 3) high or low,
+// turning the pin into an output if needed.
+// The other pins keep their level.
+func (s *Si4713Driver) SetGPO(pin int, level bool) error {
+	if pin < 1 || pin > 3 {
+		return fmt.Errorf("GPO pin %d not in 1 ... 3 bounds", pin)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.gpoOutputs&gpoMask(pin) == 0 {
+		if err := s.setGPIOCtrl(s.gpoOutputs | gpoMask(pin)); err != nil {
+			return err
+		}
+	}
+
+	if level {
+		return s.setGPIO(s.gpoLevels | gpoMask(pin))
+	}
+	return s.setGPIO(s.gpoLevels &^ gpoMask(pin))
+}
+
+// SetGPOHighImpedance puts GPO1, GPO2 or GPO3 (pin 1 to 3) in the high
+// impedance (Hi-Z) state. The other pins are left untouched.
+func (s *Si4713Driver) SetGPOHighImpedance(pin int) error {
+	if pin < 1 || pin > 3 {
+		return fmt.Errorf("GPO pin %d not in 1 ... 3 bounds", pin)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.setGPIOCtrl(s.gpoOutputs &^ gpoMask(pin))
+}
+
+// gpoMask is the CMD_GPO_SET and CMD_GPO_CTL bit of the pin.
+func gpoMask(pin int) uint8 {
+	return 1 << uint(pin)
+}
+
+// Sets the GP1 / GP2 / GP3 output levels.
+func (s *Si4713Driver) setGPIO(pin uint8) error {
+	if err := s.sendCommand(cmdSetGPIO(pin)); err != nil {
+		return err
+	}
+	s.gpoLevels = pin
+	return nil
+}
+
+// AudioQuality holds the input audio signal metrics.
+type AudioQuality struct {
+	// Status is the device status byte
+	Status byte
+
+	// Flags holds the audio signal quality interrupt flags
+	Flags byte
+
+	// InputLevelDBFS is the input audio level in dBfs
+	InputLevelDBFS int8
+}
+
+// Configures the audio signal quality thresholds and interrupts
+// for the configured audio monitoring callbacks.
+func (s *Si4713Driver) configureASQ() error {
+	var sources uint16
+	if s.OnSilence != nil {
+		if err := s.setProperty(PROP_TX_ASQ_LEVEL_LOW, uint16(uint8(s.SilenceThresholdDBFS))); err != nil {
+			return err
+		}
+		if err := s.setProperty(PROP_TX_ASQ_DURATION_LOW, s.SilenceDurationMs); err != nil {
+			return err
+		}
+		sources |= asqLow
+	}
+
+	if s.OnOvermodulation != nil {
+		if err := s.setProperty(PROP_TX_AQS_LEVEL_HIGH, uint16(uint8(s.OvermodulationThresholdDBFS))); err != nil {
+			return err
+		}
+		if err := s.setProperty(PROP_TX_AQS_DURATION_HIGH, s.OvermodulationDurationMs); err != nil {
+			return err
+		}
+		sources |= asqHigh | asqOvermodulation
+	}
+
+	if sources == 0 {
+		return nil
+	}
+	return s.setProperty(PROP_TX_ASQ_INTERRUPT_SOURCE, sources)
+}
+
+// Invokes the audio monitoring callbacks matching the audio signal quality flags.
+func (s *Si4713Driver) notifyAudioQuality(asq AudioQuality) {
+	if asq.Flags&asqLow != 0 {
+		s.Publish(EventSilenceDetected, nil)
+		if s.OnSilence != nil {
+			s.OnSilence()
+		}
+	}
+	if asq.Flags&(asqHigh|asqOvermodulation) != 0 && s.OnOvermodulation != nil {
+		s.OnOvermodulation()
+	}
+}
+
+// Reports if any of the audio monitoring callbacks are configured.
+func (s *Si4713Driver) monitorsAudio() bool {
+	return s.OnSilence != nil || s.OnOvermodulation != nil
+}
+
+// GetAudioQuality performs a status read for the TxAsqStatus.
+func (s *Si4713Driver) GetAudioQuality() (AudioQuality, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.audioQuality()
+}
+
+func (s *Si4713Driver) audioQuality() (AudioQuality, error) {
+	if err := s.sendCommand(cmdASQStatus()); err != nil {
+		return AudioQuality{}, err
+	}
+
+	values, err := s.buffRead(5)
+	if err != nil {
+		return AudioQuality{}, err
+	}
+
+	// values[2] and values[3] are discarded
+	return AudioQuality{
+		Status:         values[0],
+		Flags:          values[1],
+		InputLevelDBFS: int8(values[4]),
+	}, nil
+}
+
+// TuneStatus holds the result of a previously sent TX Tune Freq,
+// TX Tune Power, or TX Tune Measure command.
+type TuneStatus struct {
+	// FrequencyKHz is the current frequency.
+	// Value * 10 = value in MHz
+	FrequencyKHz uint16
+
+	// PowerDBuV is the current transmission power in dBuV
+	PowerDBuV uint8
+
+	// AntennaCap is the current antenna tuning capacitor value
+	AntennaCap uint8
+
+	// NoiseLevel is the received noise level, in dBuV, reported
+	// after a TX Tune Measure command
+	NoiseLevel uint8
+}
+
+// GetTuneStatus queries the status of a previously sent TX Tune Freq, TX Tune
+// Power, or TX Tune Measure using CMD_TX_TUNE_STATUS command.
+func (s *Si4713Driver) GetTuneStatus() (TuneStatus, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.tuneStatus()
+}
+
+// ReadTransmitPower queries the current transmission power, in dBuV,
+// using CMD_TX_TUNE_STATUS. See GetTuneStatus for the other values.
+func (s *Si4713Driver) ReadTransmitPower() (uint8, error) {
+	status, err := s.GetTuneStatus()
+	if err != nil {
+		return 0, err
+	}
+	return status.PowerDBuV, nil
+}
+
+func (s *Si4713Driver) tuneStatus() (TuneStatus, error) {
+	if err := s.sendCommand(cmdReadTuneStatus()); err != nil {
+		return TuneStatus{}, err
+	}
+
+	// status and resp1
+	if _, err := s.conn.ReadByte(); err != nil {
+		return TuneStatus{}, err
+	}
+	if _, err := s.conn.ReadByte(); err != nil {
+		return TuneStatus{}, err
+	}
+
+	status := TuneStatus{}
+	val, err := s.conn.ReadByte()
+	if err != nil {
+		return TuneStatus{}, err
+	}
+	status.FrequencyKHz = uint16(val) << 8
+	val, err = s.conn.ReadByte()
+	if err != nil {
+		return TuneStatus{}, err
+	}
+	status.FrequencyKHz |= uint16(val) // resp3
+
+	// resp4
+	if _, err = s.conn.ReadByte(); err != nil {
+		return TuneStatus{}, err
+	}
+
+	if status.PowerDBuV, err = s.conn.ReadByte(); err != nil {
+		return TuneStatus{}, err
+	}
+
+	if status.AntennaCap, err = s.conn.ReadByte(); err != nil {
+		return TuneStatus{}, err
+	}
+
+	if status.NoiseLevel, err = s.conn.ReadByte(); err != nil {
+		return TuneStatus{}, err
+	}
+
+	return status, nil
+}
+
+// Queries the status of a previously sent TX Tune Freq, TX Tune
+// Power, or TX Tune Measure using CMD_TX_TUNE_STATUS command.
+func (s *Si4713Driver) readTuneStatus() (currFreq uint16, currdBuV, currAntCap, currNoiseLevel uint8, err error) {
+	status, err := s.tuneStatus()
+	return status.FrequencyKHz, status.PowerDBuV, status.AntennaCap, status.NoiseLevel, err
+}
+
+// SetRDSStation sets up the RDS station string.
+func (s *Si4713Driver) SetRDSStation(stationName string) error {
+	s.mtx.Lock()
+	err := s.setRDSStation(stationName)
+	s.mtx.Unlock()
+	return s.publish(err, EventRDSUpdated, stationName)
+}
+
+func (s *Si4713Driver) setRDSStation(stationName string) error {
+	stationName, err := s.fitRDSText(s.Logger, "RDS station name", stationName, rdsStationNameLength)
+	if err != nil {
+		return err
+	}
+	name := padSlots(toRDS(stationName), 4)
+
+	slots := uint8(len(name) / 4)
+	j := 0
+	for i := uint8(0); i < slots; i++ {
+		// set slot number, then the message
+		c := cmdSetRDSStationName(i, name[j], name[j+1], name[j+2], name[j+3])
+		if err := s.sendCommand(c); err != nil {
+			return err
+		}
+		j += 4
+	}
+
+	return nil
+}
+
+// SetRDSStations sets up several RDS station names which the
+// receivers will show in turn, e.g. "DLSNIPER" and "95.5 FM".
+// Each name can hold up to 8 characters and up to 12 names can be used.
+// Use PROP_TX_RDS_PS_REPEAT_COUNT to control how long each name is shown.
+func (s *Si4713Driver) SetRDSStations(names []string) error {
+	s.mtx.Lock()
+	err := s.setRDSStations(names)
+	s.mtx.Unlock()
+	return s.publish(err, EventRDSUpdated, names)
+}
+
+func (s *Si4713Driver) setRDSStations(names []string) error {
+	if len(names) == 0 || len(names) > rdsMaxStations {
+		return fmt.Errorf("RDS station names count %d not in 1 ... %d bounds", len(names), rdsMaxStations)
+	}
+	slots := make([][]byte, len(names))
+	for i, name := range names {
+		name, err := s.fitRDSText(s.Logger, "RDS station name", name, rdsStationNameLength)
+		if err != nil {
+			return err
+		}
+		slots[i] = toRDS(name)
+	}
+
+	for i := range slots {
+		name := padSlots(slots[i], rdsStationNameLength)
+
+		// each name spans two slots
+		for j := 0; j < rdsStationNameLength; j += 4 {
+			slot := uint8(i*rdsStationNameLength+j) / 4
+			c := cmdSetRDSStationName(slot, name[j], name[j+1], name[j+2], name[j+3])
+			if err := s.sendCommand(c); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.setProperty(PROP_TX_RDS_MESSAGE_COUNT, uint16(len(names)))
+}
+
+// SetRDSMessage queries the status of the RDS Group Buffer and loads new data into buffer.
+func (s *Si4713Driver) SetRDSMessage(message string) error {
+	s.mtx.Lock()
+	err := s.setRDSMessage(message)
+	s.mtx.Unlock()
+	return s.publish(err, EventRDSUpdated, message)
+}
+
+func (s *Si4713Driver) setRDSMessage(message string) error {
+	if err := s.loadRDSMessage(message); err != nil {
+		return err
+	}
+
+	if err := s.setRDSTime(); err != nil {
+		return err
+	}
+
+	if s.DebugMode {
+		s.Logger.Debugf("Enabling the RDS subsystem...\n")
+	}
+
+	// pilot+rds, and stereo unless configured otherwise
+	return s.setProperty(PROP_TX_COMPONENT_ENABLE, s.components()|componentRDS)
+}
+
+// UpdateRadioText replaces the message sent out via RDS, like SetRDSMessage,
+// but only loads the new group buffers: the clock-time and the enabled
+// components are left as they are. Use it to change the text of a running
+// transmission, e.g. for a scrolling message.
+func (s *Si4713Driver) UpdateRadioText(message string) error {
+	s.mtx.Lock()
+	err := s.loadRDSMessage(message)
+	s.mtx.Unlock()
+	return s.publish(err, EventRDSUpdated, message)
+}
+
+// Loads the message into the RDS group buffer.
+func (s *Si4713Driver) loadRDSMessage(message string) error {
+	message, err := s.fitRDSText(s.Logger, "RDS message", message, rdsRadioTextLength)
+	if err != nil {
+		return err
+	}
+	msg := padSlots(toRDS(message), 4)
+
+	slots := uint8(len(msg) / 4)
+	groups := make([][3]uint16, 0, slots)
+	j := 0
+	for i := uint8(0); i < slots; i++ {
+		msgType := uint8(0x04)
+		if i == 0 {
+			msgType = 0x06
+		}
+
+		c := cmdSetRDSMessage(CMD_TX_RDS_BUFF, msgType, 0x20, i, msg[j], msg[j+1], msg[j+2], msg[j+3])
+		j += 4
+
+		if err := s.sendCommand(c); err != nil {
+			return err
+		}
+		groups = append(groups, [3]uint16{0x20<<8 | uint16(i), uint16(c[4])<<8 | uint16(c[5]), uint16(c[6])<<8 | uint16(c[7])})
+	}
+	s.textGroups = groups
+	return nil
+}
+
+// SetStereo switches the transmission between stereo and mono.
+// Mono transmission saves deviation budget and reduces multipath
+// by dropping the pilot tone and the L-R channel.
+// RDS stays enabled if HasRDS is set.
+func (s *Si4713Driver) SetStereo(enabled bool) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	mono := s.Mono
+	s.Mono = !enabled
+	if err := s.setProperty(PROP_TX_COMPONENT_ENABLE, s.components()); err != nil {
+		s.Mono = mono
+		return err
+	}
+	return nil
+}
+
+// Configures the audio dynamic range control and the limiter.
+func (s *Si4713Driver) applyCompressor() error {
+	c := DefaultCompressor()
+	if s.Compressor != nil {
+		c = *s.Compressor
+	}
+
+	if err := s.setProperty(PROP_TX_ACOMP_THRESHOLD, uint16(int16(c.ThresholdDB))); err != nil {
+		return err
+	}
+	if err := s.setProperty(PROP_TX_ATTACK_TIME, uint16(c.AttackTime)); err != nil {
+		return err
+	}
+	if err := s.setProperty(PROP_TX_RELEASE_TIME, uint16(c.ReleaseTime)); err != nil {
+		return err
+	}
+	if err := s.setProperty(PROP_TX_ACOMP_GAIN, uint16(c.GainDB)); err != nil {
+		return err
+	}
+	if err := s.setProperty(PROP_TX_LIMITER_RELEASE_TIME, c.LimiterReleaseTime); err != nil {
+		return err
+	}
+	return s.setProperty(PROP_TX_ACOMP_ENABLE, c.enableFlags())
+}
+
+// Configures the audio and pilot deviations and the pilot frequency.
+func (s *Si4713Driver) configureAudio() error {
+	// 66.25KHz by default (chip default is 68.25)
+	if err := s.setProperty(PROP_TX_AUDIO_DEVIATION, hzToDeviation(s.AudioDeviationHz)); err != nil {
+		return err
+	}
+
+	// 6.75KHz by default
+	if err := s.setProperty(PROP_TX_PILOT_DEVIATION, hzToDeviation(s.PilotDeviationHz)); err != nil {
+		return err
+	}
+
+	// 19KHz by default
+	if err := s.setProperty(PROP_TX_PILOT_FREQUENCY, s.PilotFrequencyHz); err != nil {
+		return err
+	}
+
+	// 636 mVPK by default
+	return s.setProperty(PROP_TX_LINE_LEVEL_INPUT_LEVEL, lineInputLevel(s.LineInputLevelMV))
+}
+
+// SetAudioDeviation changes the audio frequency deviation, in Hz, up to 90000.
+func (s *Si4713Driver) SetAudioDeviation(hz uint32) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if hz > maxAudioDeviation {
+		return fmt.Errorf("audio deviation %d not in 0 ... %d Hz bounds", hz, maxAudioDeviation)
+	}
+
+	if err := s.setProperty(PROP_TX_AUDIO_DEVIATION, hzToDeviation(hz)); err != nil {
+		return err
+	}
+	s.AudioDeviationHz = hz
+	return nil
+}
+
+// SetPilotDeviation changes the pilot tone frequency deviation, in Hz, up to 90000.
+func (s *Si4713Driver) SetPilotDeviation(hz uint32) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if hz > maxPilotDeviation {
+		return fmt.Errorf("pilot deviation %d not in 0 ... %d Hz bounds", hz, maxPilotDeviation)
+	}
+
+	if err := s.setProperty(PROP_TX_PILOT_DEVIATION, hzToDeviation(hz)); err != nil {
+		return err
+	}
+	s.PilotDeviationHz = hz
+	return nil
+}
 
-	val, err := s.conn.ReadByte()
-	if err != nil {
-		return 0, 0, 0, 0, err
+// SetPilotFrequency changes the frequency of the stereo pilot, in Hz,
+// between 18000 and 19000.
+func (s *Si4713Driver) SetPilotFrequency(hz uint16) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if hz < minPilotFrequency || hz > maxPilotFrequency {
+		return fmt.Errorf("pilot frequency %d not in %d ... %d Hz bounds", hz, minPilotFrequency, maxPilotFrequency)
 	}
-	currFreq = uint16(val) << 8
-	val, err = s.conn.ReadByte()
-	if err != nil {
-		return 0, 0, 0, 0, err
+
+	if err := s.setProperty(PROP_TX_PILOT_FREQUENCY, hz); err != nil {
+		return err
 	}
-	currFreq |= uint16(val) // resp3
+	s.PilotFrequencyHz = hz
+	return nil
+}
 
-	// resp4
-	if _, err = s.conn.ReadByte(); err != nil {
-		return 0, 0, 0, 0, err
+// SetRDSDeviation changes the RDS frequency deviation, in Hz, up to 7500.
+// A higher deviation makes RDS more robust at the expense of the audio headroom.
+func (s *Si4713Driver) SetRDSDeviation(hz uint16) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if hz > maxRDSDeviation {
+		return fmt.Errorf("RDS deviation %d not in 0 ... %d Hz bounds", hz, maxRDSDeviation)
 	}
 
-	currdBuV, err = s.conn.ReadByte()
-	if err != nil {
-		return 0, 0, 0, 0, err
+	if err := s.setProperty(PROP_TX_RDS_DEVIATION, hzToDeviation(uint32(hz))); err != nil {
+		return err
 	}
+	s.RDSDeviationHz = hz
+	return nil
+}
 
-	currAntCap, err = s.conn.ReadByte()
-	if err != nil {
-		return 0, 0, 0, 0, err
+// SetRDSMixRatio changes the share of the RDS groups used by the station names.
+func (s *Si4713Driver) SetRDSMixRatio(mix RDSMix) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if mix > RDSMixPSOnly {
+		return fmt.Errorf("invalid RDS mix ratio %d", mix)
 	}
 
-	currNoiseLevel, err = s.conn.ReadByte()
-	return currFreq, currdBuV, currAntCap, currNoiseLevel, err
+	if err := s.setProperty(PROP_TX_RDS_PS_MIX, rdsMixValues[mix]); err != nil {
+		return err
+	}
+	s.RDSMixRatio = mix
+	return nil
 }
 
-// SetRDSStation sets up the RDS station string.
-//
-//goland:noinspection GoUnnecessarilyExportedIdentifiers
-func (s *Si4713Driver) SetRDSStation(stationName string) error {
-	j := len(stationName) / 4
-	name := []byte(stationName)
-	// pad the name so that we can add nulls at the end of the command, if needed
-	for i := len(stationName) - j*4; i > 0 && i < 4; i++ {
-		name = append(name, ' ')
+// SetRDSPSRepeatCount changes the number of times, between 1 and 255,
+// each station name is repeated before showing the next one.
+func (s *Si4713Driver) SetRDSPSRepeatCount(n uint16) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if n < 1 || n > maxRDSPSRepeatCount {
+		return fmt.Errorf("RDS station name repeat count %d not in 1 ... %d bounds", n, maxRDSPSRepeatCount)
 	}
 
-	slots := uint8((len(stationName) + 3) / 4)
-	j = 0
-	for i := uint8(0); i < slots; i++ {
-		// set slot number, then the message
-		c := cmdSetRDSStationName(i, name[j], name[j+1], name[j+2], name[j+3])
-		if err := s.sendCommand(c); err != nil {
-			return err
-		}
-		j += 4
+	if err := s.setProperty(PROP_TX_RDS_PS_REPEAT_COUNT, n); err != nil {
+		return err
+	}
+	s.RDSPSRepeatCount = n
+	return nil
+}
+
+// SetLineInputLevel changes the maximum line input level, in mVPK, up to 636.
+// It should match the peak output level of the audio source.
+func (s *Si4713Driver) SetLineInputLevel(mv uint16) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if mv == 0 || mv > maxLineInputLevel {
+		return fmt.Errorf("line input level %d not in 1 ... %d mVPK bounds", mv, maxLineInputLevel)
 	}
 
+	if err := s.setProperty(PROP_TX_LINE_LEVEL_INPUT_LEVEL, lineInputLevel(mv)); err != nil {
+		return err
+	}
+	s.LineInputLevelMV = mv
 	return nil
 }
 
-// SetRDSMessage queries the status of the RDS Group Buffer and loads new data into buffer.
-func (s *Si4713Driver) SetRDSMessage(message string) error {
-	j := len(message) / 4
-	msg := []byte(message)
-	// pad the name so that we can add nulls at the end of the command, if needed
-	for i := len(message) - j*4; i > 0 && i < 4; i++ {
-		msg = append(msg, ' ')
+// lineInputLevel encodes the PROP_TX_LINE_LEVEL_INPUT_LEVEL value for the
+// input level, using the lowest input attenuation which can handle it.
+// The attenuation also sets the input resistance: 60, 38, 30 or 20 kΩ.
+func lineInputLevel(mv uint16) uint16 {
+	atten := uint16(0)
+	for atten < uint16(len(lineInputAttenuations))-1 && lineInputAttenuations[atten] < mv {
+		atten++
 	}
+	return atten<<12 | mv&0x3FF
+}
 
-	slots := uint8((len(message) + 3) / 4)
-	j = 0
-	for i := uint8(0); i < slots; i++ {
-		msgType := uint8(0x04)
+// hzToDeviation converts a deviation in Hz to the 10 Hz units used by the device.
+func hzToDeviation(hz uint32) uint16 {
+	return uint16((hz + 5) / 10)
+}
+
+// MuteLineInput mutes the left and/or right line inputs independently.
+// It can be used at runtime, e.g. when the audio feed is only on one channel.
+func (s *Si4713Driver) MuteLineInput(muteLeft, muteRight bool) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var mute uint16
+	if muteLeft {
+		mute |= lineInputMuteLeft
+	}
+	if muteRight {
+		mute |= lineInputMuteRight
+	}
+	return s.setProperty(PROP_TX_LINE_INPUT_MUTE, mute)
+}
+
+// SetProgramType changes the RDS program type (PTY) code, between 0 and 31.
+func (s *Si4713Driver) SetProgramType(pty uint8) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if pty > 31 {
+		return fmt.Errorf("RDS program type %d not in 0 ... 31 bounds", pty)
+	}
+
+	programType := s.ProgramType
+	s.ProgramType = pty
+	if err := s.setProperty(PROP_TX_RDS_PS_MISC, s.psMisc()); err != nil {
+		s.ProgramType = programType
+		return err
+	}
+	return nil
+}
+
+// SetTrafficAnnouncement signals the start or the end of a traffic announcement.
+func (s *Si4713Driver) SetTrafficAnnouncement(on bool) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	announcement := s.TrafficAnnouncement
+	s.TrafficAnnouncement = on
+	if err := s.setProperty(PROP_TX_RDS_PS_MISC, s.psMisc()); err != nil {
+		s.TrafficAnnouncement = announcement
+		return err
+	}
+	return nil
+}
+
+// ProgramTypeName returns the name of the configured program type in the configured region.
+func (c *Si4713Config) ProgramTypeName() string {
+	return c.Region.ProgramTypeName(c.ProgramType)
+}
+
+// psMisc computes the PROP_TX_RDS_PS_MISC value for the current configuration.
+func (s *Si4713Driver) psMisc() uint16 {
+	res := uint16(psMiscBase) | uint16(s.ProgramType&0x1F)<<psMiscPTYShift
+	if s.TrafficProgram {
+		res |= psMiscTP
+	}
+	if s.TrafficAnnouncement {
+		res |= psMiscTA
+	}
+	return res
+}
+
+// components computes the PROP_TX_COMPONENT_ENABLE value for the current configuration.
+func (s *Si4713Driver) components() uint16 {
+	var res uint16
+	if !s.Mono {
+		res |= componentPilot | componentLMR
+	}
+	if s.HasRDS {
+		res |= componentRDS
+	}
+	return res
+}
+
+// SetRadioText sends up to 64 characters of RadioText using 2A groups.
+// The text A/B flag is flipped each time the text changes, which tells
+// the receivers to clear the previous text.
+func (s *Si4713Driver) SetRadioText(text string) error {
+	s.mtx.Lock()
+	err := s.setRadioText(text)
+	s.mtx.Unlock()
+	return s.publish(err, EventRDSUpdated, text)
+}
+
+func (s *Si4713Driver) setRadioText(text string) error {
+	text, err := s.fitRDSText(s.Logger, "RadioText", text, rdsRadioTextLength)
+	if err != nil {
+		return err
+	}
+	msg := toRDS(text)
+
+	if len(msg) < rdsRadioTextLength {
+		// a carriage return marks the end of a shorter text
+		msg = append(msg, '\r')
+	}
+	msg = padSlots(msg, 4)
+
+	textB := s.radioTextB
+	if s.radioText != "" && s.radioText != text {
+		textB = !textB
+	}
+
+	var ab uint16
+	if textB {
+		ab = 1 << 4
+	}
+
+	groups := make([][3]uint16, 0, len(msg)/4)
+	for i := 0; i < len(msg); i += 4 {
+		flags := uint8(rdsBuffLoad)
 		if i == 0 {
-			msgType = 0x06
+			flags |= rdsBuffEmpty
 		}
 
-		c := cmdSetRDSMessage(CMD_TX_RDS_BUFF, msgType, 0x20, i, msg[j], msg[j+1], msg[j+2], msg[j+3])
-		j += 4
-
-		if err := s.sendCommand(c); err != nil {
+		b := s.groupB(groupTypeRadioText) | ab | uint16(i/4)
+		c := uint16(msg[i])<<8 | uint16(msg[i+1])
+		d := uint16(msg[i+2])<<8 | uint16(msg[i+3])
+		if err := s.sendCommand(cmdRDSGroup(flags, b, c, d)); err != nil {
 			return err
 		}
+		groups = append(groups, [3]uint16{b, c, d})
 	}
 
-	if err := s.setRDSTime(); err != nil {
-		return err
+	s.radioText = text
+	s.radioTextB = textB
+	s.textGroups = groups
+	return nil
+}
+
+// rdsGroupBlocks is the number of FIFO blocks used by a group, B, C and D.
+const rdsGroupBlocks = 3
+
+// rdsFIFOBlocks is the size of the FIFO, holding a full RadioText reloaded
+// by the RDS pump and the clock-time group. The FIFO shares the RDS group
+// buffer with the circular buffer, which shrinks by as many blocks.
+const rdsFIFOBlocks = (rdsRadioTextLength/4 + 1) * rdsGroupBlocks
+
+// StartRDSPump checks the RDS FIFO each interval and, when less than a
+// RadioText is left in it, loads the RadioText groups again, keeping the
+// receivers updated between the circular buffer repeats.
+// The returned stop function stops the checks.
+func (s *Si4713Driver) StartRDSPump(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			s.mtx.Lock()
+			overflow, err := s.refillRDS()
+			s.mtx.Unlock()
+			if err != nil {
+				s.Logger.Errorf("Refilling the RDS FIFO: %v\n", err)
+			}
+			if overflow && s.OnRDSOverflow != nil {
+				s.OnRDSOverflow()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+// refillRDS loads the RadioText groups in the FIFO when it holds less than them.
+// It reports whether the FIFO had no room left for them.
+func (s *Si4713Driver) refillRDS() (overflow bool, err error) {
+	if len(s.textGroups) == 0 {
+		return false, nil
+	}
+
+	status, err := s.readDeviceStatus()
+	if err != nil {
+		return false, err
+	}
+	if int(status.FifoUsed) >= len(s.textGroups)*rdsGroupBlocks {
+		return false, nil
 	}
 
 	if s.DebugMode {
-		s.DebugLog("Enabling the RDS subsystem...\n")
+		s.Logger.Debugf("Refilling the RDS FIFO, %d blocks used\n", status.FifoUsed)
 	}
+	loaded, err := s.loadFIFO(status, s.textGroups...)
+	if err != nil {
+		return false, err
+	}
+	return !loaded, nil
+}
+
+// loadFIFO loads the groups in the RDS FIFO when the status reports room
+// for all of them, as the device drops the groups loaded in a full FIFO.
+// It reports whether the groups were loaded.
+// The circular buffer wraps reported by the status are acknowledged.
+func (s *Si4713Driver) loadFIFO(status DeviceStatus, groups ...[3]uint16) (bool, error) {
+	if status.Flags&rdsIntCircularWrap != 0 {
+		if err := s.sendCommand(cmdRDSGroup(rdsBuffIntAck, 0, 0, 0)); err != nil {
+			return false, err
+		}
+	}
+	if int(status.FifoAvailable) < len(groups)*rdsGroupBlocks {
+		return false, nil
+	}
+	for _, g := range groups {
+		if err := s.sendCommand(cmdRDSGroup(rdsBuffFIFO|rdsBuffLoad, g[0], g[1], g[2])); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// fitRDSText returns text if it fits in max characters. Otherwise, with
+// TruncateRDSText set, it truncates the text and logs the cut using what as
+// the field name, or returns an error when truncation is disabled.
+func (c *Si4713Config) fitRDSText(logger Logger, what, text string, max int) (string, error) {
+	chars := []rune(text)
+	if len(chars) <= max {
+		return text, nil
+	}
+	if !c.TruncateRDSText {
+		return "", fmt.Errorf("%s %q is longer than %d characters", what, text, max)
+	}
+
+	res := string(chars[:max])
+	logger.Infof("%s %q is longer than %d characters, truncating it to %q\n", what, text, max, res)
+	return res, nil
+}
 
-	// stereo, pilot+rds
-	return s.setProperty(PROP_TX_COMPONENT_ENABLE, 0x0007)
+// padSlots pads the text with spaces up to a multiple of the slot size,
+// so that every slot can be filled.
+func padSlots(text []byte, size int) []byte {
+	for len(text)%size != 0 {
+		text = append(text, ' ')
+	}
+	return text
 }
 
-// Configures GP1 / GP2 as output or Hi-Z.
+// Configures GP1 / GP2 / GP3 as output or Hi-Z.
 func (s *Si4713Driver) setGPIOCtrl(pin uint8) error {
-	return s.sendCommand(cmdSetGPIOCtrl(pin))
+	if err := s.sendCommand(cmdSetGPIOCtrl(pin)); err != nil {
+		return err
+	}
+	s.gpoOutputs = pin
+	return nil
 }
 
 // Resets the registers to default settings and puts chip in.
-func (s *Si4713Driver) reset() (err error) {
+func (s *Si4713Driver) reset(ctx context.Context) (err error) {
+	if s.Simulate {
+		return nil
+	}
+
 	dw, ok := s.i2cConnector.(gpio.DigitalWriter)
 	if !ok {
-		return fmt.Errorf("i2c connector does not have a digital writter capability")
+		return ErrNoDigitalWriter
 	}
 
 	if err = dw.DigitalWrite(s.ResetPin, high); err != nil {
 		return err
 	}
-	time.Sleep(10 * time.Millisecond)
+	if err = s.sleep(ctx, s.ResetPulse); err != nil {
+		return err
+	}
 
 	if err = dw.DigitalWrite(s.ResetPin, low); err != nil {
 		return err
 	}
-	time.Sleep(10 * time.Millisecond)
+	if err = s.sleep(ctx, s.ResetPulse); err != nil {
+		return err
+	}
 
 	return dw.DigitalWrite(s.ResetPin, high)
 }
 
+// Reset toggles the reset pin of the device, which then needs to be
+// started again. The i2c connector must be a gpio.DigitalWriter.
+func (s *Si4713Driver) Reset() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.reset(context.Background())
+}
+
 // Sends power up command to the breakout, then CTS and GPO2 output
 // is disabled and then enable cristal oscillator.
+// With the digital audio input, it configures the input format and sample rate.
 // Also, it sets properties:
-//            PROP_REFCLK_FREQ: 32.768
-//            PROP_TX_PREEMPHASIS: 74uS pre-emphasis (USA standard)
-//            PROP_TX_ACOMP_GAIN: max gain
-//            PROP_TX_ACOMP_ENABLE: turned on limiter and AGC
+//            PROP_REFCLK_FREQ: 32.768, or as configured
+//            PROP_REFCLK_PRESCALE: 1, or as configured
+//            PROP_TX_PREEMPHASIS: configured pre-emphasis, 75uS (USA standard) by default
+//            PROP_TX_ACOMP_*, PROP_TX_LIMITER_RELEASE_TIME: configured compressor, limiter with 10 dB gain by default
 //
 func (s *Si4713Driver) powerUp() error {
-	if err := s.sendCommand(cmdPowerUp()); err != nil {
+	opMode := uint8(opModeAnalog)
+	if s.AudioInput == AudioInputDigital {
+		opMode = opModeDigital
+	}
+	if err := s.sendCommand(cmdPowerUp(opMode)); err != nil {
 		return err
 	}
 
-	// Crystal is 32.768
-	if err := s.setProperty(PROP_REFCLK_FREQ, 32768); err != nil {
-		return err
+	if s.AudioInput == AudioInputDigital {
+		if err := s.setProperty(PROP_DIGITAL_INPUT_FORMAT, s.DigitalFormat); err != nil {
+			return err
+		}
+		if err := s.setProperty(PROP_DIGITAL_INPUT_SAMPLE_RATE, s.DigitalSampleRate); err != nil {
+			return err
+		}
 	}
 
-	// 74uS pre-emphasis (USA std)
-	if err := s.setProperty(PROP_TX_PREEMPHASIS, 0); err != nil {
+	// Crystal is 32.768 unless configured otherwise
+	refClkFreq := s.RefClkFreq
+	if s.DisableAFC {
+		refClkFreq = 0
+	}
+	if err := s.setProperty(PROP_REFCLK_FREQ, refClkFreq); err != nil {
 		return err
 	}
-
-	// max gain?
-	if err := s.setProperty(PROP_TX_ACOMP_ENABLE, 0x02); err != nil {
+	if err := s.setProperty(PROP_REFCLK_PRESCALE, s.RefClkPrescale); err != nil {
 		return err
 	}
 
-	// turn on the limiter, but no dynamic ranging
-	if err := s.setProperty(PROP_TX_ACOMP_GAIN, 10); err != nil {
+	// 75uS pre-emphasis (USA std) unless configured otherwise
+	if err := s.setProperty(PROP_TX_PREEMPHASIS, uint16(s.PreEmphasis)); err != nil {
 		return err
 	}
 
-	// turn on the limiter and AGC
-	return s.setProperty(PROP_TX_ACOMP_ENABLE, 0x02)
+	// limiter with 10 dB gain unless configured otherwise
+	return s.applyCompressor()
 }
 
 // Turn off the device.
@@ -773,8 +2409,8 @@ func (s *Si4713Driver) powerDown() error {
 
 // Setups the i2cConnector and calls powerUp function.
 // Returns true if initialization was successful, otherwise false.
-func (s *Si4713Driver) begin() (bool, error) {
-	if err := s.reset(); err != nil {
+func (s *Si4713Driver) begin(ctx context.Context) (bool, error) {
+	if err := s.reset(ctx); err != nil {
 		return false, err
 	}
 	if err := s.powerUp(); err != nil {
@@ -782,115 +2418,312 @@ func (s *Si4713Driver) begin() (bool, error) {
 	}
 
 	// check for Si4713Driver
-	status, err := s.getRev()
-	return status == 13, err
+	rev, err := s.revision()
+	if err != nil {
+		return false, err
+	}
+	return rev.PartNumber == 13, nil
+}
+
+// Revision holds the hardware revision information of the device.
+type Revision struct {
+	// PartNumber is the final two digits of the part number, e.g. 13 for Si4713
+	PartNumber uint8
+
+	// Firmware is the firmware version
+	Firmware uint16
+
+	// Patch is the patch ID
+	Patch uint16
+
+	// Component is the component firmware version
+	Component uint16
+
+	// ChipRev is the chip revision
+	ChipRev uint8
+}
+
+// GetRevision reads the hardware revision information from the device using CMD_GET_REV.
+func (s *Si4713Driver) GetRevision() (Revision, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.revision()
 }
 
-// Get the hardware revision code from the device using CMD_GET_REV.
-func (s *Si4713Driver) getRev() (uint8, error) {
+func (s *Si4713Driver) revision() (Revision, error) {
 	if err := s.sendCommand(cmdGetRev()); err != nil {
-		return 0, err
+		return Revision{}, err
 	}
 
 	values, err := s.buffRead(9)
 	if err != nil {
-		return 0, err
+		return Revision{}, err
+	}
+
+	rev := Revision{
+		PartNumber: values[1],
+		Firmware:   uint16(values[2])<<8 | uint16(values[3]),
+		Patch:      uint16(values[4])<<8 | uint16(values[5]),
+		Component:  uint16(values[6])<<8 | uint16(values[7]),
+		ChipRev:    values[8],
+	}
+
+	if s.DebugMode {
+		s.Logger.Debugf("Part # Si47%d-%x", rev.PartNumber, rev.Firmware)
+		s.Logger.Debugf("Firmware %x\n", rev.Firmware)
+		s.Logger.Debugf("Patch %x\n", rev.Patch)
+		s.Logger.Debugf("Chip rev %d\n", rev.ChipRev)
+	}
+
+	return rev, nil
+}
+
+// Tunes to given transmit frequency.
+func (s *Si4713Driver) tuneFM(ctx context.Context, freqKHz uint16) error {
+	h := uint8(freqKHz >> 8)
+	l := uint8(freqKHz & 0xFF)
+	if err := s.sendCommandContext(ctx, cmdTuneFM(h, l)); err != nil {
+		return err
 	}
 
-	partNumber := values[1]
+	deadline := time.Now().Add(s.TuneTimeout)
+	for {
+		status, err := s.getStatus(ctx)
+		if err != nil {
+			return err
+		}
+		if status&0x81 == 0x81 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for tuning to complete")
+		}
+		if err := s.sleep(ctx, 10*time.Millisecond); err != nil {
+			return err
+		}
+	}
+}
+
+//  Read interrupt status bits.
+// The other bits are only valid with CTS, so it waits for it.
+func (s *Si4713Driver) getStatus(ctx context.Context) (uint8, error) {
+	return s.sendCommandStatus(ctx, command{CMD_GET_INT_STATUS})
+}
+
+// DeviceStatus holds the RDS group buffer and FIFO metrics.
+type DeviceStatus struct {
+	// CircularAvailable is the number of free blocks in the circular buffer
+	CircularAvailable uint8
 
-	fw := uint16(values[2])
-	fw <<= 8
-	fw |= uint16(values[3])
+	// CircularUsed is the number of used blocks in the circular buffer
+	CircularUsed uint8
 
-	patch := uint16(values[4])
-	patch <<= 8
-	patch |= uint16(values[5])
+	// FifoAvailable is the number of free blocks in the FIFO
+	FifoAvailable uint8
 
-	cmp := uint16(values[6])
-	cmp <<= 8
-	cmp |= uint16(values[7])
+	// FifoUsed is the number of used blocks in the FIFO
+	FifoUsed uint8
 
-	chipRev := values[8]
+	// Flags holds the RDS interrupt flags, RDSINTS, such as the circular
+	// buffer wrapping or the FIFO getting empty. They stay set until acknowledged.
+	Flags uint8
+}
+
+// ReadDeviceStatus queries the RDS group buffer and FIFO metrics
+// using CMD_TX_RDS_BUFF, without loading any group.
+func (s *Si4713Driver) ReadDeviceStatus() (DeviceStatus, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.readDeviceStatus()
+}
+
+func (s *Si4713Driver) readDeviceStatus() (DeviceStatus, error) {
+	if err := s.sendCommand(cmdRDSGroup(0, 0, 0, 0)); err != nil {
+		return DeviceStatus{}, err
+	}
+
+	values, err := s.buffRead(6)
+	if err != nil {
+		return DeviceStatus{}, err
+	}
+
+	// values[0] discarded
+	return DeviceStatus{
+		CircularAvailable: values[2],
+		CircularUsed:      values[3],
+		FifoAvailable:     values[4],
+		FifoUsed:          values[5],
+		Flags:             values[1],
+	}, nil
+}
+
+// Get the device status.
+func (s *Si4713Driver) deviceStatus() (err error) {
+	status, err := s.readDeviceStatus()
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Debugf("Circular avail: %d used: %d\n", status.CircularAvailable, status.CircularUsed)
+	s.Logger.Debugf("FIFO avail: %d used: %d flags: 0x%02x\n", status.FifoAvailable, status.FifoUsed, status.Flags)
+	return nil
+}
 
+// Measure the received noise level at the specified frequency,
+// with the antenna capacitor or 0 for the automatic tuning.
+func (s *Si4713Driver) readTuneMeasure(ctx context.Context, freq uint16, antCap uint8) error {
+	// check freq is multiple of 50khz
+	if freq%5 != 0 {
+		freq -= freq % 5
+	}
 	if s.DebugMode {
-		s.DebugLog("Part # Si47%d-%x", partNumber, fw)
-		s.DebugLog("Firmware %x\n", fw)
-		s.DebugLog("Patch %x\n", patch)
-		s.DebugLog("Chip rev %d\n", chipRev)
+		s.Logger.Debugf("Measuring frequency: %.2f MHz\n", float32(freq)/100)
+	}
+
+	h := uint8(freq >> 8)
+	l := uint8(freq & 0xFF)
+	if err := s.sendCommandContext(ctx, cmdTuneMeasure(h, l, antCap)); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(s.TuneTimeout)
+	for {
+		status, err := s.getStatus(ctx)
+		if err != nil {
+			return err
+		}
+		if status == 0x81 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the measurement to complete")
+		}
+		if err := s.sleep(ctx, 10*time.Millisecond); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTransmitFrequency tunes the transmission to another frequency while the device
+// is running. The frequency is in 10 kHz units and must be between 8750 and 10800.
+func (s *Si4713Driver) SetTransmitFrequency(freq uint16) error {
+	s.mtx.Lock()
+	err := s.setTransmitFrequency(freq)
+	s.mtx.Unlock()
+	return s.publish(err, EventTuned, freq)
+}
+
+func (s *Si4713Driver) setTransmitFrequency(freq uint16) error {
+	if err := s.tuneTransmitFrequency(freq); err != nil {
+		return err
+	}
+
+	s.TransmitFrequency = freq
+	return nil
+}
+
+// StepFrequency moves the transmission frequency up or down by delta, in 10 kHz
+// units, e.g. 10 for the next 100 kHz channel or -100 for 1 MHz lower.
+// The new frequency is clamped to the 8750 ... 10800 band.
+func (s *Si4713Driver) StepFrequency(deltaKHz int16) error {
+	s.mtx.Lock()
+	freq := int(s.TransmitFrequency) + int(deltaKHz)
+	if freq < 8750 {
+		freq = 8750
+	} else if freq > 10800 {
+		freq = 10800
+	}
+	err := s.setTransmitFrequency(uint16(freq))
+	s.mtx.Unlock()
+	return s.publish(err, EventTuned, uint16(freq))
+}
+
+// TuneAndVerify tunes the transmission to another frequency, like
+// SetTransmitFrequency, then reads back the frequency reported by the device.
+// An ErrTuneMismatch is returned when it differs from freqKHz by more than
+// tolerance, both in 10 kHz units.
+func (s *Si4713Driver) TuneAndVerify(freqKHz uint16, tolerance uint16) error {
+	s.mtx.Lock()
+	err := s.tuneAndVerify(freqKHz, tolerance)
+	s.mtx.Unlock()
+	return s.publish(err, EventTuned, freqKHz)
+}
+
+func (s *Si4713Driver) tuneAndVerify(freqKHz uint16, tolerance uint16) error {
+	if err := s.tuneTransmitFrequency(freqKHz); err != nil {
+		return err
+	}
+
+	curr, _, _, _, err := s.readTuneStatus()
+	if err != nil {
+		return err
+	}
+	diff := curr - freqKHz
+	if curr < freqKHz {
+		diff = freqKHz - curr
+	}
+	if diff > tolerance {
+		return fmt.Errorf("tuned to %d instead of %d: %w", curr, freqKHz, ErrTuneMismatch)
 	}
 
-	return partNumber, nil
+	s.TransmitFrequency = freqKHz
+	return nil
 }
 
-// Tunes to given transmit frequency.
-func (s *Si4713Driver) tuneFM(freqKHz uint16) error {
-	h := uint8(freqKHz >> 8)
-	l := uint8(freqKHz & 0xFF)
-	if err := s.sendCommand(cmdTuneFM(h, l)); err != nil {
-		return err
+func (s *Si4713Driver) tuneTransmitFrequency(freq uint16) error {
+	if freq < 8750 || freq > 10800 {
+		return fmt.Errorf("transmission frequency %d: %w", freq, ErrFrequencyOutOfRange)
 	}
 
-	for {
-		status, err := s.getStatus()
-		if err != nil {
-			return nil
-		}
-		if status&0x81 == 0x81 {
-			return nil
-		}
-		time.Sleep(10 * time.Millisecond)
+	if s.DebugMode {
+		s.Logger.Debugf("Tuning into %.2f\n", float32(freq)/100)
 	}
+	return s.tuneFM(context.Background(), freq)
 }
 
-//  Read interrupt status bits.
-func (s *Si4713Driver) getStatus() (uint8, error) {
-	if err := s.conn.WriteByte(CMD_GET_INT_STATUS); err != nil {
-		return 0, err
-	}
-
-	return s.conn.ReadByte()
+// SetTransmitPower changes the output power while the device is running.
+// The power is in dBuV and must be between 88 and 115.
+// The antenna capacitor is kept, see SetAntennaCap.
+func (s *Si4713Driver) SetTransmitPower(dBuV uint8) error {
+	s.mtx.Lock()
+	err := s.setTransmitPower(dBuV)
+	s.mtx.Unlock()
+	return s.publish(err, EventPowerChanged, dBuV)
 }
 
-// Get the device status.
-func (s *Si4713Driver) deviceStatus() (err error) {
-	values, err := s.buffRead(6)
-	if err != nil {
+func (s *Si4713Driver) setTransmitPower(dBuV uint8) error {
+	if dBuV < 88 || dBuV > 115 {
+		return fmt.Errorf("transmit power %d not in 88 ... 115 dBuV bounds", dBuV)
+	}
+
+	if s.DebugMode {
+		s.Logger.Debugf("Set TX power %d\n", dBuV)
+	}
+	if err := s.setTxPower(dBuV, s.AntennaCap); err != nil {
 		return err
 	}
 
-	// values[0] discarded
-	s.DebugLog("Circular avail: %d used: %d\n", values[2], values[3])
-	s.DebugLog("FIFO avail: %d used: %d overflow: %d\n", values[4], values[5], values[1])
+	s.TransmitPower = dBuV
 	return nil
 }
 
-// Measure the received noise level at the specified frequency.
-func (s *Si4713Driver) readTuneMeasure(freq uint16) error {
-	// check freq is multiple of 50khz
-	if freq%5 != 0 {
-		freq -= freq % 5
-	}
-	if s.DebugMode {
-		s.DebugLog("Measuring frequency: %.2f MHz\n", float32(freq)/100)
+// SetAntennaCap changes the antenna tuning capacitor while the device is running,
+// in 0.25 pF steps. The capacitor must be at most 191, 0 tunes it automatically.
+// GetTuneStatus reports the capacitor in use.
+func (s *Si4713Driver) SetAntennaCap(antCap uint8) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if antCap > maxAntennaCap {
+		return fmt.Errorf("antenna capacitor %d not in 0 ... %d bounds", antCap, maxAntennaCap)
 	}
 
-	h := uint8(freq >> 8)
-	l := uint8(freq & 0xFF)
-	if err := s.sendCommand(cmdTuneMeasure(h, l)); err != nil {
+	if err := s.setTxPower(s.TransmitPower, antCap); err != nil {
 		return err
 	}
 
-	for {
-		status, err := s.getStatus()
-		if err != nil {
-			return err
-		}
-		if status == 0x81 {
-			break
-		}
-		time.Sleep(10 * time.Millisecond)
-	}
+	s.AntennaCap = antCap
 	return nil
 }
 
@@ -899,10 +2732,27 @@ func (s *Si4713Driver) setTxPower(pwr, antCap uint8) error {
 	return s.sendCommand(cmdSetTxPower(pwr, antCap))
 }
 
+// SetProperty sets a chip property over I2C.
+//
+// It is meant for tuning the properties that don't have a dedicated method.
+// The properties are described by the PROP_* constants and are grouped as follows:
+//     0x0001 - 0x0202: interrupts, digital input and reference clock
+//     0x2100 - 0x2107: transmit components, deviation levels, line input and pilot
+//     0x2200 - 0x2205: audio dynamic range control and limiter
+//     0x2300 - 0x2304: audio signal quality
+//     0x2C00 - 0x2C07: RDS
+// Refer to AN332 for the valid values of each property, as the chip
+// does not report invalid values.
+func (s *Si4713Driver) SetProperty(property, value uint16) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.setProperty(property, value)
+}
+
 // Set chip property over I2C.
 func (s *Si4713Driver) setProperty(property uint16, value uint16) error {
 	if s.DebugMode {
-		s.DebugLog("Set Prop 0x%x = 0x%x (%d)\n", property, value, value)
+		s.Logger.Debugf("Set Prop 0x%x = 0x%x (%d)\n", property, value, value)
 	}
 
 	p := cmdSetProperty()
@@ -914,27 +2764,44 @@ func (s *Si4713Driver) setProperty(property uint16, value uint16) error {
 	return s.sendCommand(p)
 }
 
+// GetProperty reads the value of a chip property over I2C.
+func (s *Si4713Driver) GetProperty(property uint16) (uint16, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := s.sendCommand(cmdGetProperty(uint8(property>>8), uint8(property&0xFF))); err != nil {
+		return 0, err
+	}
+
+	// status, resp1, then the property value
+	values, err := s.buffRead(4)
+	if err != nil {
+		return 0, err
+	}
+
+	value := uint16(values[2])<<8 | uint16(values[3])
+	if s.DebugMode {
+		s.Logger.Debugf("Get Prop 0x%x = 0x%x (%d)\n", property, value, value)
+	}
+
+	return value, nil
+}
+
 //  Begin RDS
 //
 //  Sets properties as follows:
-//  	PROP_TX_AUDIO_DEVIATION: 66.25KHz,
-//  	PROP_TX_RDS_DEVIATION: 2KHz,
+//  	PROP_TX_RDS_DEVIATION: 2KHz, or as configured,
 //  	PROP_TX_RDS_INTERRUPT_SOURCE: 1,
-//  	PROP_TX_RDS_PS_MIX: 50% mix (default value),
-//  	PROP_TX_RDS_PS_MISC: 6152,
-//  	PROP_TX_RDS_PS_REPEAT_COUNT: 3,
+//  	PROP_TX_RDS_PS_MIX: 50% mix (default value), or as configured,
+//  	PROP_TX_RDS_PS_MISC: 6152 with the program type,
+//  	PROP_TX_RDS_PS_REPEAT_COUNT: 3, or as configured,
 //  	PROP_TX_RDS_MESSAGE_COUNT: 1,
-//  	PROP_TX_RDS_PS_AF: 57568,
-//  	PROP_TX_RDS_FIFO_SIZE: 0,
-//  	PROP_TX_COMPONENT_ENABLE: 7
+//  	PROP_TX_RDS_PS_AF: 0xE0E0 (no AF), or the configured AF,
+//  	PROP_TX_RDS_FIFO_SIZE: rdsFIFOBlocks + 1, for the RDS pump and clock-time,
+//  	PROP_TX_COMPONENT_ENABLE: 7, or 4 in mono
 func (s *Si4713Driver) beginRDS(programID uint16) error {
-	// 66.25KHz (default is 68.25)
-	if err := s.setProperty(PROP_TX_AUDIO_DEVIATION, 6625); err != nil {
-		return err
-	}
-
-	// 2KHz (default)
-	if err := s.setProperty(PROP_TX_RDS_DEVIATION, 200); err != nil {
+	// 2KHz (default) unless configured otherwise
+	if err := s.setProperty(PROP_TX_RDS_DEVIATION, hzToDeviation(uint32(s.RDSDeviationHz))); err != nil {
 		return err
 	}
 
@@ -946,16 +2813,16 @@ func (s *Si4713Driver) beginRDS(programID uint16) error {
 	if err := s.setProperty(PROP_TX_RDS_PI, programID); err != nil {
 		return err
 	}
-	// 50% mix (default)
-	if err := s.setProperty(PROP_TX_RDS_PS_MIX, 0x03); err != nil {
+	// 50% mix (default) unless configured otherwise
+	if err := s.setProperty(PROP_TX_RDS_PS_MIX, rdsMixValues[s.RDSMixRatio]); err != nil {
 		return err
 	}
-	// RDSD0 & RDSMS (default)
-	if err := s.setProperty(PROP_TX_RDS_PS_MISC, 0x1808); err != nil {
+	// RDSD0 & RDSMS (default), plus the program type
+	if err := s.setProperty(PROP_TX_RDS_PS_MISC, s.psMisc()); err != nil {
 		return err
 	}
-	// 3 repeats (default)
-	if err := s.setProperty(PROP_TX_RDS_PS_REPEAT_COUNT, 3); err != nil {
+	// 3 repeats (default) unless configured otherwise
+	if err := s.setProperty(PROP_TX_RDS_PS_REPEAT_COUNT, s.RDSPSRepeatCount); err != nil {
 		return err
 	}
 
@@ -963,75 +2830,248 @@ func (s *Si4713Driver) beginRDS(programID uint16) error {
 		return err
 	}
 
-	if err := s.setProperty(PROP_TX_RDS_PS_AF, s.AlternateFrequency); err != nil {
+	af := alternateFrequencyCode(s.AlternateFrequency)
+	if len(s.afWords) > 0 {
+		af = s.afWords[0]
+		s.afIndex = 0
+	}
+	if err := s.setProperty(PROP_TX_RDS_PS_AF, af); err != nil {
 		return err
 	}
-	if err := s.setProperty(PROP_TX_RDS_FIFO_SIZE, 0); err != nil {
+	// the value written is one larger than the FIFO size, 0 disables it
+	if err := s.setProperty(PROP_TX_RDS_FIFO_SIZE, rdsFIFOBlocks+1); err != nil {
 		return err
 	}
 
-	return s.setProperty(PROP_TX_COMPONENT_ENABLE, 0x0007)
+	return s.setProperty(PROP_TX_COMPONENT_ENABLE, s.components()|componentRDS)
 }
 
 // Send command to the radio chip.
-func (s *Si4713Driver) sendCommand(cmd command) (err error) {
+func (s *Si4713Driver) sendCommand(cmd command) error {
+	return s.sendCommandContext(context.Background(), cmd)
+}
+
+// Send command to the radio chip, waiting for CTS until the context is done.
+// The idempotent commands are sent again, up to MaxRetries times, on i2c errors.
+func (s *Si4713Driver) sendCommandContext(ctx context.Context, cmd command) error {
+	_, err := s.sendCommandStatus(ctx, cmd)
+	return err
+}
+
+// Send command to the radio chip like sendCommandContext,
+// returning the status read with CTS.
+func (s *Si4713Driver) sendCommandStatus(ctx context.Context, cmd command) (uint8, error) {
+	for attempt := uint8(0); ; attempt++ {
+		status, err := s.trySendCommand(ctx, cmd)
+		busErr, ok := err.(i2cError)
+		if !ok {
+			return status, err
+		}
+		if attempt >= s.MaxRetries || !retryable(cmd) {
+			return 0, busErr.err
+		}
+
+		s.Logger.Infof("i2c error on command 0x%x, retrying: %v\n", cmd[0], busErr.err)
+		if err := s.sleep(ctx, time.Duration(attempt+1)*retryBackoff); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// retryable tells if the command can be sent again after an i2c error.
+// The device may have taken the command before the error, so only the
+// commands having the same effect when sent twice are: powering up again
+// fails and loading an RDS group again transmits it twice.
+func retryable(cmd command) bool {
+	switch cmd[0] {
+	case CMD_POWER_UP:
+		return false
+	case CMD_TX_RDS_BUFF:
+		return len(cmd) < 2 || cmd[1]&rdsBuffLoad == 0
+	}
+	return true
+}
+
+// i2cError marks the errors returned by the i2c bus, which can be retried.
+type i2cError struct {
+	err error
+}
+
+func (e i2cError) Error() string {
+	return e.err.Error()
+}
+
+// Send command to the radio chip once, waiting for CTS until the context is done.
+func (s *Si4713Driver) trySendCommand(ctx context.Context, cmd command) (uint8, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	if s.DebugMode {
-		s.DebugLog("*** Command: %s\n", s.sliceToString(cmd))
+		s.Logger.Debugf("*** Command: %s\n", s.sliceToString(cmd))
 	}
-	if _, err = s.conn.Write(cmd); err != nil {
-		return err
+	if _, err := s.conn.Write(cmd); err != nil {
+		return 0, i2cError{err}
 	}
 
 	if cmd[0] == CMD_POWER_DOWN {
-		return nil
+		return 0, nil
 	}
+	return s.waitCTS(ctx)
+}
 
-	// Wait for status CTS bit
-	status := byte(0)
-	for status&STATUS_CTS == 0 {
-		status, err = s.conn.ReadByte()
+// Wait for status CTS bit, returning the status.
+func (s *Si4713Driver) waitCTS(ctx context.Context) (uint8, error) {
+	deadline := time.Now().Add(s.CommandTimeout)
+	for {
+		status := []byte{0}
+		n, err := s.conn.Read(status)
 		if err != nil {
-			return err
+			return 0, i2cError{err}
+		}
+		if n != 1 {
+			return 0, i2cError{fmt.Errorf("failed to read the status, read %d bytes", n)}
 		}
 		if s.DebugMode {
-			s.DebugLog("status: %x (%d)\n", status, status)
+			s.Logger.Debugf("status: %x (%d)\n", status[0], status[0])
 		}
+		if status[0]&STATUS_CTS != 0 {
+			return status[0], nil
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("timed out waiting for CTS")
+		}
+		if err := s.sleep(ctx, ctsPollInterval); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// sleep waits for the duration using sleepFunc, when set.
+func (s *Si4713Driver) sleep(ctx context.Context, d time.Duration) error {
+	if s.sleepFunc != nil {
+		return s.sleepFunc(ctx, d)
 	}
+	return sleep(ctx, d)
+}
 
-	return nil
+// sleep waits for the duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
 }
 
 func (s *Si4713Driver) setRDSTime() error {
-	return s.sendCommand(cmdSetRDSMessage(CMD_TX_RDS_BUFF, 0x84, 0x40, 01, 0xA7, 0x0B, 0x2D, 0x6C))
+	return s.setClockTime(time.Now())
 }
 
-// Loop performs the main application loop to transmit data and check the device status.
-func (s *Si4713Driver) Loop() error {
-	if !s.DebugMode {
-		return nil
+// SetClockTime sends the given time as an RDS clock-time group.
+// Loop sends the current time each minute while RDS is enabled.
+// It returns ErrRDSFIFOFull when the FIFO has no room for the group.
+func (s *Si4713Driver) SetClockTime(t time.Time) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.setClockTime(t)
+}
+
+func (s *Si4713Driver) setClockTime(t time.Time) error {
+	status, err := s.readDeviceStatus()
+	if err != nil {
+		return err
+	}
+
+	b, c, d := clockTimeBlocks(t)
+	loaded, err := s.loadFIFO(status, [3]uint16{s.groupB(groupTypeClockTime) | b, c, d})
+	if err != nil {
+		return err
+	}
+	if !loaded {
+		return ErrRDSFIFOFull
 	}
 
-	status, currASQ, currInLevel, err := s.readASQ()
+	s.clockTimeSent = t.Truncate(time.Minute)
+	return nil
+}
+
+// Sends the clock-time group at the start of each minute.
+// When the FIFO is full, it reports the overflow and the group is sent
+// again on the next call.
+func (s *Si4713Driver) refreshClockTime(now time.Time) (overflow bool, err error) {
+	if now.Truncate(time.Minute).Equal(s.clockTimeSent) {
+		return false, nil
+	}
+	err = s.setClockTime(now)
+	if errors.Is(err, ErrRDSFIFOFull) {
+		return true, nil
+	}
+	return false, err
+}
+
+// Loop performs the main application loop to transmit data and check the device status.
+func (s *Si4713Driver) Loop() error {
+	asq, overflow, err := s.loop()
 	if err != nil {
 		return err
 	}
 
-	s.DebugLog("Curr Status: 0x%x ASQ: 0x%x InLevel: %d dBfs\n", status, currASQ, int8(currInLevel))
+	// the callbacks run unlocked, so they can use the driver
+	s.notifyAudioQuality(asq)
+	if overflow && s.OnRDSOverflow != nil {
+		s.OnRDSOverflow()
+	}
+
+	if !s.DebugMode {
+		return nil
+	}
+
+	s.Logger.Debugf("Curr Status: 0x%x ASQ: 0x%x InLevel: %d dBfs\n", asq.Status, asq.Flags, asq.InputLevelDBFS)
 
 	// toggle GPO1 and GPO2
-	if err = s.SetGPIO(1 << 1); err != nil {
+	if err = s.SetGPIO(gpoMask(1)); err != nil {
 		return err
 	}
-	time.Sleep(500 * time.Millisecond)
+	_ = s.sleep(context.Background(), 500*time.Millisecond)
 
-	if err = s.SetGPIO(1 << 2); err != nil {
+	if err = s.SetGPIO(gpoMask(2)); err != nil {
 		return err
 	}
-	time.Sleep(500 * time.Millisecond)
+	_ = s.sleep(context.Background(), 500*time.Millisecond)
 
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
 	return s.deviceStatus()
 }
 
+// Sends the RDS clock-time, reporting whether the FIFO overflowed,
+// and reads the audio signal quality when the audio is monitored
+// or in debugging mode.
+func (s *Si4713Driver) loop() (asq AudioQuality, rdsOverflow bool, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.HasRDS {
+		if rdsOverflow, err = s.refreshClockTime(time.Now()); err != nil {
+			return AudioQuality{}, false, err
+		}
+		if err := s.rotateAlternateFrequencies(); err != nil {
+			return AudioQuality{}, false, err
+		}
+	}
+
+	if !s.DebugMode && !s.monitorsAudio() {
+		return AudioQuality{}, rdsOverflow, nil
+	}
+
+	asq, err = s.audioQuality()
+	return asq, rdsOverflow, err
+}
+
 func (s *Si4713Driver) buffRead(size int) ([]byte, error) {
 	values := make([]byte, size)
 	nValues, err := s.conn.Read(values)
@@ -1040,11 +3080,11 @@ func (s *Si4713Driver) buffRead(size int) ([]byte, error) {
 	}
 
 	if nValues != size {
-		return nil, fmt.Errorf("failed to read %d bytes from the line, read %d -> %s", size, len(values), s.sliceToString(values))
+		return nil, fmt.Errorf("failed to read %d bytes from the line, read %d -> %s", size, nValues, s.sliceToString(values[:nValues]))
 	}
 
 	if s.DebugMode {
-		s.DebugLog("read %d bytes: %s", size, s.sliceToString(values))
+		s.Logger.Debugf("read %d bytes: %s", size, s.sliceToString(values))
 	}
 	return values, nil
 }
@@ -1057,61 +3097,269 @@ func (s *Si4713Driver) sliceToString(val []byte) string {
 	return res
 }
 
+// MHzToRaw converts a frequency in MHz to the 10 kHz units used by the device,
+// e.g. 95.5 MHz is 9550. The frequency must be between 87.50 MHz and 108 MHz.
+func MHzToRaw(mhz float64) (uint16, error) {
+	raw := math.Round(mhz * 100)
+	if raw < 8750 || raw > 10800 {
+		return 0, fmt.Errorf("%.2f MHz: %w", mhz, ErrFrequencyOutOfRange)
+	}
+	return uint16(raw), nil
+}
+
+// RawToMHz converts a frequency in the 10 kHz units used by the device to MHz.
+func RawToMHz(raw uint16) float64 {
+	return float64(raw) / 100
+}
+
+// NewSi4713Config creates a configuration transmitting on the given frequency,
+// in MHz, with the given logging function.
+func NewSi4713Config(transmitMHz float64, log func(format string, v ...interface{})) (Si4713Config, error) {
+	freq, err := MHzToRaw(transmitMHz)
+	if err != nil {
+		return Si4713Config{}, err
+	}
+
+	return Si4713Config{
+		Log:               log,
+		TransmitFrequency: freq,
+	}, nil
+}
+
 // Validate ensures that our Si4713Driver configuration is valid.
-//noinspection GoUnnecessarilyExportedIdentifiers
 func (c *Si4713Config) Validate() error {
-	if c.Log == nil {
-		panic("logging function cannot be nil. Use something like log.Printf or an empty function instead")
-	}
-	if c.DebugMode && c.DebugLog == nil {
-		panic("cannot use debugging mode without configuring a DebugLog function, e.g. log.Printf")
+	if c.Logger == nil {
+		if c.DebugMode && c.DebugLog == nil {
+			return ErrNilLogger
+		}
+		c.Logger = funcLogger{debug: c.DebugLog, info: c.Log}
 	}
+	return c.validate(c.Logger)
+}
 
+// validate checks the settings and fills in their defaults, reporting
+// the adjustments to the logger. Unlike Validate, it doesn't need the
+// logging functions to be set.
+func (c *Si4713Config) validate(logger Logger) error {
 	if c.ResetPin == "" {
 		c.ResetPin = "29"
 	}
 
-	if c.TransmitFrequency == 0 {
+	if c.ResetPulse <= 0 {
+		c.ResetPulse = 10 * time.Millisecond
+	}
+	if c.ResetPulse > maxResetPulse {
+		return fmt.Errorf("reset pulse %v not in 0 ... %v bounds", c.ResetPulse, maxResetPulse)
+	}
+
+	if c.SettleDelay < 0 || c.SettleDelay > maxSettleDelay {
+		return fmt.Errorf("settle delay %v not in 0 ... %v bounds", c.SettleDelay, maxSettleDelay)
+	}
+
+	if c.CommandTimeout <= 0 {
+		c.CommandTimeout = 100 * time.Millisecond
+	}
+
+	if c.TuneTimeout <= 0 {
+		c.TuneTimeout = 500 * time.Millisecond
+	}
+
+	if c.TransmitFrequency == 0 && !c.WithFrequencyScan {
 		return fmt.Errorf("FM transmission frequency not set")
 	}
 
-	if c.TransmitFrequency < 8750 || c.TransmitFrequency > 10800 {
-		return fmt.Errorf("FM transmission frequency not in 87.50 MHz ... 108 MHz bounds")
+	if c.TransmitFrequency != 0 && (c.TransmitFrequency < 8750 || c.TransmitFrequency > 10800) {
+		return fmt.Errorf("transmission frequency %d: %w", c.TransmitFrequency, ErrFrequencyOutOfRange)
+	}
+
+	if c.ChannelSpacing != 0 && c.TransmitFrequency != 0 {
+		if freq := snapToChannel(c.TransmitFrequency, c.ChannelSpacing); freq != c.TransmitFrequency {
+			if c.SnapToChannel {
+				logger.Infof("FM transmission frequency %d is not on the %d channel grid, moving it to %d\n", c.TransmitFrequency, c.ChannelSpacing, freq)
+				c.TransmitFrequency = freq
+			} else {
+				logger.Infof("FM transmission frequency %d is not on the %d channel grid, the closest channel is %d\n", c.TransmitFrequency, c.ChannelSpacing, freq)
+			}
+		}
+	}
+
+	if c.AlternateFrequency != 0 && !validAlternateFrequency(c.AlternateFrequency) {
+		logger.Infof("FM alternate transmission frequency %d not in 87.60 MHz ... 107.90 MHz bounds, not announcing it\n", c.AlternateFrequency)
+		c.AlternateFrequency = 0
+	}
+
+	if c.AntennaCap > maxAntennaCap {
+		return fmt.Errorf("antenna capacitor %d not in 0 ... %d bounds", c.AntennaCap, maxAntennaCap)
+	}
+
+	if c.AudioDeviationHz == 0 {
+		c.AudioDeviationHz = 66250
+	}
+	if c.AudioDeviationHz > maxAudioDeviation {
+		return fmt.Errorf("audio deviation %d not in 0 ... %d Hz bounds", c.AudioDeviationHz, maxAudioDeviation)
+	}
+
+	if c.Compressor != nil {
+		if err := c.Compressor.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.LineInputLevelMV == 0 {
+		c.LineInputLevelMV = maxLineInputLevel
+	}
+	if c.LineInputLevelMV > maxLineInputLevel {
+		return fmt.Errorf("line input level %d not in 1 ... %d mVPK bounds", c.LineInputLevelMV, maxLineInputLevel)
+	}
+
+	if c.PilotDeviationHz == 0 {
+		c.PilotDeviationHz = 6750
+	}
+	if c.PilotDeviationHz > maxPilotDeviation {
+		return fmt.Errorf("pilot deviation %d not in 0 ... %d Hz bounds", c.PilotDeviationHz, maxPilotDeviation)
+	}
+
+	if c.PilotFrequencyHz == 0 {
+		c.PilotFrequencyHz = 19000
+	}
+	if c.PilotFrequencyHz < minPilotFrequency || c.PilotFrequencyHz > maxPilotFrequency {
+		return fmt.Errorf("pilot frequency %d not in %d ... %d Hz bounds", c.PilotFrequencyHz, minPilotFrequency, maxPilotFrequency)
+	}
+
+	if c.RDSDeviationHz == 0 {
+		c.RDSDeviationHz = 2000
+	}
+	if c.RDSDeviationHz > maxRDSDeviation {
+		return fmt.Errorf("RDS deviation %d not in 0 ... %d Hz bounds", c.RDSDeviationHz, maxRDSDeviation)
+	}
+
+	if c.RDSMixRatio > RDSMixPSOnly {
+		return fmt.Errorf("invalid RDS mix ratio %d", c.RDSMixRatio)
+	}
+
+	if c.RDSPSRepeatCount == 0 {
+		c.RDSPSRepeatCount = 3
+	}
+	if c.RDSPSRepeatCount > maxRDSPSRepeatCount {
+		return fmt.Errorf("RDS station name repeat count %d not in 1 ... %d bounds", c.RDSPSRepeatCount, maxRDSPSRepeatCount)
+	}
+
+	if c.RefClkFreq == 0 {
+		c.RefClkFreq = 32768
+	}
+	if c.RefClkFreq < 31130 || c.RefClkFreq > 34406 {
+		return fmt.Errorf("reference clock frequency %d not in 31130 ... 34406 Hz bounds", c.RefClkFreq)
+	}
+
+	if c.RefClkPrescale == 0 {
+		c.RefClkPrescale = 1
+	}
+	if c.RefClkPrescale&0x0FFF == 0 || c.RefClkPrescale > 0x1FFF {
+		return fmt.Errorf("invalid reference clock prescaler 0x%x", c.RefClkPrescale)
+	}
+
+	switch c.AudioInput {
+	case AudioInputAnalog:
+	case AudioInputDigital:
+		if c.DigitalSampleRate == 0 {
+			c.DigitalSampleRate = 48000
+		}
+		if c.DigitalSampleRate < 32000 || c.DigitalSampleRate > 48000 {
+			return fmt.Errorf("digital input sample rate %d not in 32000 ... 48000 Hz bounds", c.DigitalSampleRate)
+		}
+	default:
+		return fmt.Errorf("invalid audio input %d", c.AudioInput)
 	}
 
-	if c.AlternateFrequency < 8750 || c.AlternateFrequency > 10800 {
-		c.Log("FM alternate transmission frequency not in 87.50 MHz ... 108 MHz bounds, defaulting to %d\n", 8750)
-		c.AlternateFrequency = 8750
+	if c.PreEmphasis > PreEmphasisOff {
+		return fmt.Errorf("invalid pre-emphasis setting %d", c.PreEmphasis)
+	}
+
+	if c.OnSilence != nil {
+		if c.SilenceThresholdDBFS == 0 {
+			c.SilenceThresholdDBFS = -50
+		}
+		if c.SilenceThresholdDBFS < -70 || c.SilenceThresholdDBFS > 0 {
+			return fmt.Errorf("silence threshold %d not in -70 ... 0 dBFS bounds", c.SilenceThresholdDBFS)
+		}
+		if c.SilenceDurationMs == 0 {
+			c.SilenceDurationMs = 10000
+		}
+	}
+
+	if c.OnOvermodulation != nil {
+		if c.OvermodulationThresholdDBFS == 0 {
+			c.OvermodulationThresholdDBFS = -10
+		}
+		if c.OvermodulationThresholdDBFS < -70 || c.OvermodulationThresholdDBFS > 0 {
+			return fmt.Errorf("overmodulation threshold %d not in -70 ... 0 dBFS bounds", c.OvermodulationThresholdDBFS)
+		}
+		if c.OvermodulationDurationMs == 0 {
+			c.OvermodulationDurationMs = 50
+		}
 	}
 
 	// dBuV, 88-115 max
 	if c.TransmitPower < 88 {
-		c.Log("Transmit power %d < 88. Adjusting to minimum of 88.\n", c.TransmitPower)
+		logger.Infof("Transmit power %d < 88. Adjusting to minimum of 88.\n", c.TransmitPower)
 		c.TransmitPower = 88
 	} else if c.TransmitPower > 115 {
-		c.Log("Transmit power %d > 115. Adjusting to maximum of 115.\n", c.TransmitPower)
+		logger.Infof("Transmit power %d > 115. Adjusting to maximum of 115.\n", c.TransmitPower)
 		c.TransmitPower = 115
 	}
 
+	var err error
+	if c.RDSStationName, err = c.fitRDSText(logger, "RDS station name", c.RDSStationName, rdsStationNameLength); err != nil {
+		return err
+	}
+	if c.RDSMessage, err = c.fitRDSText(logger, "RDS message", c.RDSMessage, rdsRadioTextLength); err != nil {
+		return err
+	}
+
+	if c.ProgramType > 31 {
+		return fmt.Errorf("RDS program type %d not in 0 ... 31 bounds", c.ProgramType)
+	}
+
+	if c.Region > RegionNorthAmerica {
+		return fmt.Errorf("invalid region %d", c.Region)
+	}
+
+	if c.CallSign != "" {
+		if c.Region != RegionNorthAmerica {
+			return fmt.Errorf("call signs are only used in North America")
+		}
+
+		programID, err := PICodeFromCallSign(c.CallSign)
+		if err != nil {
+			return err
+		}
+		c.RDSProgramID = programID
+	}
+
 	// If we don't have a valid program ID, then we can set a default one
 	if c.RDSProgramID < 1 {
-		c.RDSProgramID = 0x3104
+		if c.HasRDS {
+			if c.RequireRDSProgramID {
+				return ErrNoProgramID
+			}
+			logger.Infof("RDS program ID not set, defaulting to 0x%04X\n", DefaultRDSProgramID)
+		}
+		c.RDSProgramID = DefaultRDSProgramID
 	}
 
 	return nil
 }
 
-// NewSi4713Driver creates a new Gobot driver for our FM transmitter
+// NewSi4713Driver creates a new Gobot driver for our FM transmitter.
+// The options, such as WithTransmitFrequency or i2c.WithAddress,
+// are applied before validating the configuration.
 func NewSi4713Driver(connector i2c.Connector, cfg Si4713Config, options ...func(i2c.Config)) (*Si4713Driver, error) {
-	if err := cfg.Validate(); err != nil {
-		return nil, err
-	}
-
 	res := &Si4713Driver{
 		name:         gobot.DefaultName("Si4713Driver"),
 		i2cConnector: connector,
 		Config:       i2c.NewConfig(),
-		i2cAddr:      Address,
+		Commander:    gobot.NewCommander(),
+		Eventer:      gobot.NewEventer(),
 
 		Si4713Config: cfg,
 	}
@@ -1120,5 +3368,78 @@ func NewSi4713Driver(connector i2c.Connector, cfg Si4713Config, options ...func(
 		option(res)
 	}
 
+	if err := res.Validate(); err != nil {
+		return nil, err
+	}
+
+	if res.Si4713Config.Name != "" {
+		res.name = res.Si4713Config.Name
+	}
+
+	addr := Address
+	if res.UseAlternateAddress {
+		addr = AlternativeAddress
+	}
+
+	res.i2cAddr = res.GetAddressOrDefault(addr)
+	if res.i2cAddr != Address && res.i2cAddr != AlternativeAddress {
+		return nil, fmt.Errorf("i2c address 0x%02x is not 0x%02x or 0x%02x", res.i2cAddr, Address, AlternativeAddress)
+	}
+
+	res.addCommands()
+	res.addEvents()
+
 	return res, nil
 }
+
+// withConfig creates an option changing the configuration of a Si4713Driver.
+// It has no effect on other drivers.
+func withConfig(apply func(cfg *Si4713Config)) func(i2c.Config) {
+	return func(c i2c.Config) {
+		if s, ok := c.(*Si4713Driver); ok {
+			apply(&s.Si4713Config)
+		}
+	}
+}
+
+// WithSleep replaces the waits between the device operations, e.g. with a
+// fake clock in the tests. The sleep function must return the context error
+// when the context is done. The default uses a time.Timer.
+func WithSleep(sleep func(ctx context.Context, d time.Duration) error) func(i2c.Config) {
+	return func(c i2c.Config) {
+		if s, ok := c.(*Si4713Driver); ok {
+			s.sleepFunc = sleep
+		}
+	}
+}
+
+// WithLog sets the logging function, e.g. log.Printf.
+func WithLog(log func(format string, v ...interface{})) func(i2c.Config) {
+	return withConfig(func(cfg *Si4713Config) {
+		cfg.Log = log
+	})
+}
+
+// WithTransmitFrequency sets the transmission frequency, in 10 kHz units.
+func WithTransmitFrequency(freq uint16) func(i2c.Config) {
+	return withConfig(func(cfg *Si4713Config) {
+		cfg.TransmitFrequency = freq
+	})
+}
+
+// WithTransmitPower sets the transmission power, in dBuV.
+func WithTransmitPower(dBuV uint8) func(i2c.Config) {
+	return withConfig(func(cfg *Si4713Config) {
+		cfg.TransmitPower = dBuV
+	})
+}
+
+// WithRDS enables RDS with the given program ID, station name and message.
+func WithRDS(programID uint16, station, message string) func(i2c.Config) {
+	return withConfig(func(cfg *Si4713Config) {
+		cfg.HasRDS = true
+		cfg.RDSProgramID = programID
+		cfg.RDSStationName = station
+		cfg.RDSMessage = message
+	})
+}
@@ -1,7 +1,9 @@
 package radio_test
 
 import (
+	"fmt"
 	"log"
+	"testing"
 	"time"
 
 	"fmradio/radio"
@@ -10,26 +12,45 @@ import (
 	"gobot.io/x/gobot/platforms/raspi"
 )
 
-func ExampleSi4713Driver() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-
-	stationName := "DlSnIpEr Inc."
-	rdsMessage := "DlSnIpEr in the mix"
-
-	adaptor := raspi.NewAdaptor()
+const (
+	// exampleStationName is the RDS station name, up to 8 characters
+	exampleStationName = "DLSNIPER"
+	exampleRDSMessage  = "DlSnIpEr in the mix"
+)
 
-	radioConfig := radio.Si4713Config{
+// exampleConfig is the configuration of ExampleSi4713Driver,
+// which needs the hardware and can't run as a test.
+func exampleConfig() radio.Si4713Config {
+	return radio.Si4713Config{
 		TransmitFrequency: 8850,
 		TransmitPower:     115,
 		ResetPin:          "29",
 		DebugMode:         false,
 		HasRDS:            true,
 		RDSProgramID:      0x3104,
-		RDSStationName:    stationName,
-		RDSMessage:        rdsMessage,
+		RDSStationName:    exampleStationName,
+		RDSMessage:        exampleRDSMessage,
 		Log:               log.Printf,
 		DebugLog:          nil,
 	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	cfg := exampleConfig()
+	cfg.Log = t.Logf
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ExampleSi4713Driver() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	rdsMessage := exampleRDSMessage
+
+	adaptor := raspi.NewAdaptor()
+
+	radioConfig := exampleConfig()
 	rdio, err := radio.NewSi4713Driver(adaptor, radioConfig)
 	if err != nil {
 		log.Fatalln(err)
@@ -57,3 +78,20 @@ func ExampleSi4713Driver() {
 		log.Fatalln(err)
 	}
 }
+
+func ExampleSi4713Config() {
+	cfg := radio.Si4713Config{
+		TransmitFrequency: 9550,
+		HasRDS:            true,
+		RDSProgramID:      0x3104,
+		RDSStationName:    "DLSNIPER",
+		RDSMessage:        "DlSnIpEr in the mix",
+		Log:               func(string, ...interface{}) {},
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("%.2f MHz, PI 0x%X, %s: %s\n", radio.RawToMHz(cfg.TransmitFrequency), cfg.RDSProgramID, cfg.RDSStationName, cfg.RDSMessage)
+	// Output: 95.50 MHz, PI 0x3104, DLSNIPER: DlSnIpEr in the mix
+}
@@ -1,144 +1,50 @@
 package radio
 
 import (
-	"errors"
-	"fmt"
+	"context"
 	"sync"
+	"time"
 
-	"gobot.io/x/gobot/drivers/i2c"
+	"fmradio/radio/radiotest"
 )
 
-// I2CTestAdaptor is useful to implement tests for
-// passing i2c messages back and forth.
-type I2CTestAdaptor struct {
-	name          string
-	written       []byte
-	lastWritten   []byte
-	mtx           sync.Mutex
-	i2cConnectErr bool
-	i2cReadImpl   func(*I2CTestAdaptor, []byte) (int, error)
-	i2cWriteImpl  func(*I2CTestAdaptor, []byte) (int, error)
-}
-
-func (t *I2CTestAdaptor) DigitalWrite(/* s */ string, /* b */ byte) (err error) {
-	return nil
-}
-
-func (t *I2CTestAdaptor) Read(b []byte) (count int, err error) {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
-	return t.i2cReadImpl(t, b)
-}
-
-func (t *I2CTestAdaptor) Write(b []byte) (count int, err error) {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
-	t.written = append(t.written, b...)
-	return t.i2cWriteImpl(t, b)
-}
-
-func (t *I2CTestAdaptor) Close() error {
-	return nil
-}
-
-func (t *I2CTestAdaptor) ReadByte() (val byte, err error) {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
-	bytes := []byte{0}
-	bytesRead, err := t.i2cReadImpl(t, bytes)
-	if err != nil {
-		return 0, err
-	}
-	if bytesRead != 1 {
-		return 0, fmt.Errorf("buffer underrun")
-	}
-	val = bytes[0]
-	return
-}
-
-func (t *I2CTestAdaptor) ReadByteData(/* reg */ uint8) (val uint8, err error) {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
-	bytes := []byte{0}
-	bytesRead, err := t.i2cReadImpl(t, bytes)
-	if err != nil {
-		return 0, err
-	}
-	if bytesRead != 1 {
-		return 0, fmt.Errorf("buffer underrun")
+// propertyWrites returns the value of each write of the given property.
+func propertyWrites(adaptor *radiotest.Adaptor, property uint16) []uint16 {
+	var res []uint16
+	for _, c := range adaptor.CommandsOf(CMD_SET_PROPERTY) {
+		if uint16(c[2])<<8|uint16(c[3]) == property {
+			res = append(res, uint16(c[4])<<8|uint16(c[5]))
+		}
 	}
-	val = bytes[0]
-	return
+	return res
 }
 
-func (t *I2CTestAdaptor) ReadWordData(/* reg */ uint8) (val uint16, err error) {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
-	bytes := []byte{0, 0}
-	bytesRead, err := t.i2cReadImpl(t, bytes)
-	if err != nil {
-		return 0, err
+// fifoLoads returns the groups loaded in the RDS FIFO.
+func fifoLoads(adaptor *radiotest.Adaptor) [][]byte {
+	var res [][]byte
+	for _, c := range adaptor.CommandsOf(CMD_TX_RDS_BUFF) {
+		if c[1]&(rdsBuffFIFO|rdsBuffLoad) == rdsBuffFIFO|rdsBuffLoad {
+			res = append(res, c)
+		}
 	}
-	if bytesRead != 2 {
-		return 0, fmt.Errorf("buffer underrun")
-	}
-	l, h := bytes[0], bytes[1]
-	return (uint16(h) << 8) | uint16(l), err
-}
-
-func (t *I2CTestAdaptor) WriteByte(val byte) (err error) {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
-	t.written = append(t.written, val)
-	bytes := []byte{val}
-	_, err = t.i2cWriteImpl(t, bytes)
-	return
+	return res
 }
 
-func (t *I2CTestAdaptor) WriteByteData(reg uint8, val uint8) (err error) {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
-	t.written = append(t.written, reg)
-	t.written = append(t.written, val)
-	bytes := []byte{val}
-	_, err = t.i2cWriteImpl(t, bytes)
-	return
+// fakeClock records the sleeps of a driver instead of waiting.
+type fakeClock struct {
+	mtx   sync.Mutex
+	slept []time.Duration
 }
 
-func (t *I2CTestAdaptor) WriteWordData(reg uint8, val uint16) (err error) {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
-	t.written = append(t.written, reg)
-	l := uint8(val & 0xff)
-	h := uint8((val >> 8) & 0xff)
-	t.written = append(t.written, l)
-	t.written = append(t.written, h)
-	bytes := []byte{l, h}
-	_, err = t.i2cWriteImpl(t, bytes)
-	return
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.slept = append(c.slept, d)
+	return ctx.Err()
 }
 
-func (t *I2CTestAdaptor) WriteBlockData(reg uint8, b []byte) (err error) {
-	t.mtx.Lock()
-	defer t.mtx.Unlock()
-	t.written = append(t.written, reg)
-	t.written = append(t.written, b...)
-	_, err = t.i2cWriteImpl(t, b)
-	return
+func (c *fakeClock) sleeps() []time.Duration {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return append([]time.Duration(nil), c.slept...)
 }
-
-func (t *I2CTestAdaptor) GetConnection( /* address */ int, /* bus */ int) (connection i2c.Connection, err error) {
-	if t.i2cConnectErr {
-		return nil, errors.New("invalid i2c connection")
-	}
-	return t, nil
-}
-
-func (t *I2CTestAdaptor) GetDefaultBus() int {
-	return 0
-}
-
-func (t *I2CTestAdaptor) Name() string          { return t.name }
-func (t *I2CTestAdaptor) SetName(n string)      { t.name = n }
-func (t *I2CTestAdaptor) Connect() (err error)  { return }
-func (t *I2CTestAdaptor) Finalize() (err error) { return }
@@ -1,89 +1,2743 @@
 package radio
 
 import (
-	"math/rand"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"fmradio/radio/radiotest"
+
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/drivers/i2c"
 )
 
+// newTestDriver creates a driver which talks directly to the adaptor,
+// without going through Start, nor waiting between the operations.
+func newTestDriver(t *testing.T, adaptor *radiotest.Adaptor, cfg Si4713Config) *Si4713Driver {
+	t.Helper()
+
+	if cfg.TransmitFrequency == 0 {
+		cfg.TransmitFrequency = 9550
+	}
+	if cfg.Log == nil {
+		cfg.Log = t.Logf
+	}
+
+	s, err := NewSi4713Driver(adaptor, cfg, WithSleep((&fakeClock{}).sleep))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.conn = adaptor
+
+	return s
+}
+
+func TestSetTransmitPower(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{TransmitPower: 115})
+
+	if err := s.SetTransmitPower(100); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds := adaptor.CommandsOf(CMD_TX_TUNE_POWER)
+	if len(cmds) != 1 {
+		t.Fatalf("got %d power commands, want 1", len(cmds))
+	}
+	if cmds[0][3] != 100 || cmds[0][4] != 0 {
+		t.Errorf("got power %d antenna cap %d, want 100 and 0", cmds[0][3], cmds[0][4])
+	}
+	if s.TransmitPower != 100 {
+		t.Errorf("got configured power %d, want 100", s.TransmitPower)
+	}
+
+	for _, pwr := range []uint8{0, 87, 116} {
+		if err := s.SetTransmitPower(pwr); err == nil {
+			t.Errorf("expected an error for power %d", pwr)
+		}
+	}
+	if s.TransmitPower != 100 {
+		t.Errorf("got configured power %d after invalid values, want 100", s.TransmitPower)
+	}
+}
+
+func TestGetTuneStatus(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		// CTS, status, resp1, frequency high and low, resp4, power, antenna cap, noise
+		CMD_TX_TUNE_STATUS: {STATUS_CTS, STATUS_CTS, 0, 0x25, 0x4E, 0, 115, 42, 17},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	status, err := s.GetTuneStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := TuneStatus{FrequencyKHz: 9550, PowerDBuV: 115, AntennaCap: 42, NoiseLevel: 17}
+	if status != want {
+		t.Errorf("got %+v, want %+v", status, want)
+	}
+}
+
+func TestReadTransmitPower(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_TUNE_STATUS: {STATUS_CTS, STATUS_CTS, 0, 0x25, 0x4E, 0, 112, 42, 17},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	pwr, err := s.ReadTransmitPower()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pwr != 112 {
+		t.Errorf("got power %d dBuV, want 112", pwr)
+	}
+	if got := adaptor.CommandsOf(CMD_TX_TUNE_STATUS); len(got) != 1 {
+		t.Errorf("got %d tune status commands, want 1", len(got))
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		// the STC bit without CTS is not trusted
+		CMD_GET_INT_STATUS: {0x01, 0x00, STATUS_CTS | 0x01},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	status, err := s.getStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != STATUS_CTS|0x01 {
+		t.Errorf("got status 0x%02x, want 0x81", status)
+	}
+
+	// the first read after the command comes back empty
+	adaptor = radiotest.NewAdaptor(nil)
+	adaptor.ReadImpl = func(b []byte) (int, error) {
+		if adaptor.LastCommand()[0] == CMD_GET_INT_STATUS {
+			return 0, nil
+		}
+		for i := range b {
+			b[i] = radiotest.DefaultStatus
+		}
+		return len(b), nil
+	}
+	s = newTestDriver(t, adaptor, Si4713Config{})
+
+	if _, err := s.getStatus(context.Background()); err == nil {
+		t.Error("expected an error for an incomplete read")
+	}
+	if err := s.SetTransmitFrequency(9550); err == nil {
+		t.Error("expected the tuning to fail on an incomplete status read")
+	}
+}
+
+func TestGetStatusPollsCTS(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_GET_INT_STATUS: {0x00, 0x00, 0x00, STATUS_CTS | 0x01},
+	})
+	clock := &fakeClock{}
+	s, err := NewSi4713Driver(adaptor, Si4713Config{TransmitFrequency: 9550, Log: t.Logf}, WithSleep(clock.sleep))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.conn = adaptor
+
+	status, err := s.getStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != STATUS_CTS|0x01 {
+		t.Errorf("got status 0x%02x, want 0x81", status)
+	}
+	want := []time.Duration{ctsPollInterval, ctsPollInterval, ctsPollInterval}
+	if got := clock.sleeps(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got sleeps %v, want %v", got, want)
+	}
+}
+
+func TestStepFrequency(t *testing.T) {
+	tests := []struct {
+		freq  uint16
+		delta int16
+		want  uint16
+	}{
+		{freq: 9550, delta: 10, want: 9560},
+		{freq: 9550, delta: -100, want: 9450},
+		{freq: 10750, delta: 100, want: 10800},
+		{freq: 10800, delta: 10, want: 10800},
+		{freq: 8800, delta: -100, want: 8750},
+	}
+
+	for _, tt := range tests {
+		adaptor := radiotest.NewAdaptor(nil)
+		s := newTestDriver(t, adaptor, Si4713Config{TransmitFrequency: tt.freq})
+
+		if err := s.StepFrequency(tt.delta); err != nil {
+			t.Fatal(err)
+		}
+		if s.TransmitFrequency != tt.want {
+			t.Errorf("%d%+d: got frequency %d, want %d", tt.freq, tt.delta, s.TransmitFrequency, tt.want)
+		}
+		got := adaptor.CommandsOf(CMD_TX_TUNE_FREQ)
+		if len(got) != 1 || uint16(got[0][2])<<8|uint16(got[0][3]) != tt.want {
+			t.Errorf("%d%+d: got tune commands %v, want %d", tt.freq, tt.delta, got, tt.want)
+		}
+	}
+}
+
+func TestTuneAndVerify(t *testing.T) {
+	tests := []struct {
+		reported  uint16
+		tolerance uint16
+		wantErr   bool
+	}{
+		{reported: 9550},
+		{reported: 9555, tolerance: 5},
+		{reported: 9545, tolerance: 5},
+		{reported: 9560, tolerance: 5, wantErr: true},
+		{reported: 8750, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		adaptor := radiotest.NewAdaptor(map[byte][]byte{
+			CMD_TX_TUNE_STATUS: {STATUS_CTS, STATUS_CTS, 0, byte(tt.reported >> 8), byte(tt.reported), 0, 115, 0, 0},
+		})
+		s := newTestDriver(t, adaptor, Si4713Config{TransmitFrequency: 10000})
+
+		err := s.TuneAndVerify(9550, tt.tolerance)
+		if tt.wantErr {
+			if !errors.Is(err, ErrTuneMismatch) {
+				t.Errorf("reported %d: got error %v, want ErrTuneMismatch", tt.reported, err)
+			}
+			if s.TransmitFrequency != 10000 {
+				t.Errorf("reported %d: got frequency %d, want it unchanged", tt.reported, s.TransmitFrequency)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("reported %d: %v", tt.reported, err)
+		}
+		if s.TransmitFrequency != 9550 {
+			t.Errorf("reported %d: got frequency %d, want 9550", tt.reported, s.TransmitFrequency)
+		}
+		if got := adaptor.CommandsOf(CMD_TX_TUNE_FREQ); len(got) != 1 || got[0][2] != 0x25 || got[0][3] != 0x4E {
+			t.Errorf("got tune commands %v, want 9550", got)
+		}
+	}
+}
+
+func TestGetRevision(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_GET_REV: {STATUS_CTS, STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	rev, err := s.GetRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Revision{PartNumber: 13, Firmware: 0x3330, Patch: 0x0001, Component: 0x3230, ChipRev: 3}
+	if rev != want {
+		t.Errorf("got %+v, want %+v", rev, want)
+	}
+}
+
+func TestBeginRejectsOtherParts(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_GET_REV: {STATUS_CTS, STATUS_CTS, 12, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	begun, err := s.begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if begun {
+		t.Error("expected a Si4712 to be rejected")
+	}
+}
+
+func TestSetStereo(t *testing.T) {
+	tests := []struct {
+		hasRDS bool
+		stereo bool
+		want   uint16
+	}{
+		{hasRDS: false, stereo: true, want: 0x0003},
+		{hasRDS: false, stereo: false, want: 0x0000},
+		{hasRDS: true, stereo: true, want: 0x0007},
+		{hasRDS: true, stereo: false, want: 0x0004},
+	}
+
+	for _, tt := range tests {
+		adaptor := radiotest.NewAdaptor(nil)
+		s := newTestDriver(t, adaptor, Si4713Config{HasRDS: tt.hasRDS})
+
+		if err := s.SetStereo(tt.stereo); err != nil {
+			t.Fatal(err)
+		}
+
+		got := propertyWrites(adaptor, PROP_TX_COMPONENT_ENABLE)
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("rds %v stereo %v: got component writes %#v, want 0x%04x", tt.hasRDS, tt.stereo, got, tt.want)
+		}
+		if s.Mono == tt.stereo {
+			t.Errorf("rds %v stereo %v: got Mono %v", tt.hasRDS, tt.stereo, s.Mono)
+		}
+	}
+}
+
+func TestMuteLineInput(t *testing.T) {
+	tests := []struct {
+		left, right bool
+		want        uint16
+	}{
+		{left: false, right: false, want: 0x0000},
+		{left: false, right: true, want: 0x0001},
+		{left: true, right: false, want: 0x0002},
+		{left: true, right: true, want: 0x0003},
+	}
+
+	for _, tt := range tests {
+		adaptor := radiotest.NewAdaptor(nil)
+		s := newTestDriver(t, adaptor, Si4713Config{})
+
+		if err := s.MuteLineInput(tt.left, tt.right); err != nil {
+			t.Fatal(err)
+		}
+
+		got := propertyWrites(adaptor, PROP_TX_LINE_INPUT_MUTE)
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("left %v right %v: got mute writes %#v, want 0x%04x", tt.left, tt.right, got, tt.want)
+		}
+	}
+}
+
+func TestPreEmphasis(t *testing.T) {
+	tests := []struct {
+		name        string
+		preEmphasis PreEmphasis
+		want        uint16
+	}{
+		{name: "USA", preEmphasis: PreEmphasis75us, want: 0},
+		{name: "Europe", preEmphasis: PreEmphasis50us, want: 1},
+		{name: "Off", preEmphasis: PreEmphasisOff, want: 2},
+	}
+
+	for _, tt := range tests {
+		adaptor := radiotest.NewAdaptor(nil)
+		s := newTestDriver(t, adaptor, Si4713Config{PreEmphasis: tt.preEmphasis})
+
+		if err := s.powerUp(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := propertyWrites(adaptor, PROP_TX_PREEMPHASIS)
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s: got pre-emphasis writes %#v, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	cfg := Si4713Config{TransmitFrequency: 9550, PreEmphasis: PreEmphasisOff + 1, Log: t.Logf}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for an invalid pre-emphasis")
+	}
+}
+
+func TestGetProperty(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_GET_PROPERTY: {STATUS_CTS, STATUS_CTS, 0, 0x19, 0xE1},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	value, err := s.GetProperty(PROP_TX_AUDIO_DEVIATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 6625 {
+		t.Errorf("got value %d, want 6625", value)
+	}
+
+	cmds := adaptor.CommandsOf(CMD_GET_PROPERTY)
+	if len(cmds) != 1 || cmds[0][2] != 0x21 || cmds[0][3] != 0x01 {
+		t.Errorf("got commands %#v, want a single read of 0x2101", cmds)
+	}
+}
+
+func TestSetProperty(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	logger := &capturingLogger{}
+	s := newTestDriver(t, adaptor, Si4713Config{DebugMode: true, Logger: logger})
+
+	if err := s.SetProperty(PROP_TX_PILOT_FREQUENCY, 19000); err != nil {
+		t.Fatal(err)
+	}
+
+	want := command{CMD_SET_PROPERTY, 0, 0x21, 0x07, 0x4A, 0x38}
+	if cmd := adaptor.LastCommand(); !bytes.Equal(cmd, want) {
+		t.Errorf("got command %#v, want %#v", cmd, want)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_PILOT_FREQUENCY); !reflect.DeepEqual(got, []uint16{19000}) {
+		t.Errorf("got pilot frequency writes %v, want [19000]", got)
+	}
+
+	var logged bool
+	for _, msg := range logger.debug {
+		if msg == "Set Prop 0x2107 = 0x4a38 (19000)\n" {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Errorf("got debug messages %q, want the property write", logger.debug)
+	}
+}
+
+func TestGetAudioQuality(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_ASQ_STATUS: {STATUS_CTS, STATUS_CTS | 0x02, 0x04, 0, 0, 0xEC},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	asq, err := s.GetAudioQuality()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := AudioQuality{Status: STATUS_CTS | 0x02, Flags: 0x04, InputLevelDBFS: -20}
+	if asq != want {
+		t.Errorf("got %+v, want %+v", asq, want)
+	}
+	if len(adaptor.CommandsOf(CMD_GPO_SET)) != 0 {
+		t.Error("expected no GPIO changes")
+	}
+}
+
+func TestSilenceDetection(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_ASQ_STATUS: {STATUS_CTS, STATUS_CTS, asqLow, 0, 0, 0xB5},
+	})
+
+	silences := 0
+	s := newTestDriver(t, adaptor, Si4713Config{
+		SilenceThresholdDBFS: -60,
+		SilenceDurationMs:    5000,
+		OnSilence:            func() { silences++ },
+	})
+
+	if err := s.configureASQ(); err != nil {
+		t.Fatal(err)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_ASQ_LEVEL_LOW); len(got) != 1 || got[0] != 0x00C4 {
+		t.Errorf("got low level writes %#v, want 0x00c4", got)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_ASQ_DURATION_LOW); len(got) != 1 || got[0] != 5000 {
+		t.Errorf("got low duration writes %#v, want 5000", got)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_ASQ_INTERRUPT_SOURCE); len(got) != 1 || got[0] != asqLow {
+		t.Errorf("got interrupt source writes %#v, want 0x0001", got)
+	}
+
+	if err := s.Loop(); err != nil {
+		t.Fatal(err)
+	}
+	if silences != 1 {
+		t.Errorf("got %d silence callbacks, want 1", silences)
+	}
+}
+
+func TestOvermodulationDetection(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_ASQ_STATUS: {STATUS_CTS, STATUS_CTS, asqOvermodulation, 0, 0, 0xFE},
+	})
+
+	overmodulations := 0
+	s := newTestDriver(t, adaptor, Si4713Config{
+		OnOvermodulation: func() { overmodulations++ },
+	})
+
+	if err := s.configureASQ(); err != nil {
+		t.Fatal(err)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_AQS_LEVEL_HIGH); len(got) != 1 || got[0] != 0x00F6 {
+		t.Errorf("got high level writes %#v, want 0x00f6", got)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_ASQ_INTERRUPT_SOURCE); len(got) != 1 || got[0] != asqHigh|asqOvermodulation {
+		t.Errorf("got interrupt source writes %#v, want 0x0006", got)
+	}
+
+	if err := s.Loop(); err != nil {
+		t.Fatal(err)
+	}
+	if overmodulations != 1 {
+		t.Errorf("got %d overmodulation callbacks, want 1", overmodulations)
+	}
+
+	cfg := Si4713Config{
+		TransmitFrequency:           9550,
+		OvermodulationThresholdDBFS: -71,
+		OnOvermodulation:            func() {},
+		Log:                         t.Logf,
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for an out of range threshold")
+	}
+}
+
+func TestSetProgramType(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true, ProgramType: 10})
+
+	if got := s.psMisc(); got != 0x1948 {
+		t.Errorf("got configured PS misc 0x%04x, want 0x1948", got)
+	}
+
+	if err := s.SetProgramType(31); err != nil {
+		t.Fatal(err)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_RDS_PS_MISC); len(got) != 1 || got[0] != 0x1BE8 {
+		t.Errorf("got PS misc writes %#v, want 0x1be8", got)
+	}
+
+	if err := s.SetProgramType(32); err == nil {
+		t.Error("expected an error for program type 32")
+	}
+	if s.ProgramType != 31 {
+		t.Errorf("got program type %d, want 31", s.ProgramType)
+	}
+}
+
+func TestClockTimeBlocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		time    time.Time
+		mjd     uint32
+		b, c, d uint16
+	}{
+		{
+			name: "millennium",
+			time: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			mjd:  51544,
+			b:    0x1, c: 0x92B0, d: 0x0000,
+		},
+		{
+			name: "positive offset",
+			time: time.Date(2020, 1, 1, 14, 34, 0, 0, time.FixedZone("EET", 2*60*60)),
+			mjd:  58849,
+			b:    0x1, c: 0xCBC2, d: 0xC884,
+		},
+		{
+			name: "negative offset across midnight",
+			time: time.Date(1999, 12, 31, 19, 5, 0, 0, time.FixedZone("EST", -5*60*60)),
+			mjd:  51544,
+			b:    0x1, c: 0x92B0, d: 0x016A,
+		},
+		{
+			name: "half hour offset",
+			time: time.Date(2026, 10, 14, 21, 59, 0, 0, time.FixedZone("IST", 5*60*60+30*60)),
+			mjd:  61327,
+			b:    0x1, c: 0xDF1F, d: 0x074B,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := modifiedJulianDate(tt.time); got != tt.mjd {
+			t.Errorf("%s: got MJD %d, want %d", tt.name, got, tt.mjd)
+		}
+
+		b, c, d := clockTimeBlocks(tt.time)
+		if b != tt.b || c != tt.c || d != tt.d {
+			t.Errorf("%s: got blocks 0x%x 0x%04x 0x%04x, want 0x%x 0x%04x 0x%04x", tt.name, b, c, d, tt.b, tt.c, tt.d)
+		}
+	}
+}
+
+func TestSetClockTime(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true, ProgramType: 1})
+
+	now := time.Date(2020, 1, 1, 12, 34, 56, 0, time.UTC)
+	if err := s.SetClockTime(now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.refreshClockTime(now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds := fifoLoads(adaptor)
+	if len(cmds) != 1 {
+		t.Fatalf("got %d RDS groups, want 1", len(cmds))
+	}
+	want := []byte{CMD_TX_RDS_BUFF, 0x84, 0x40, 0x21, 0xCB, 0xC2, 0xC8, 0x80}
+	if !bytes.Equal(cmds[0], want) {
+		t.Errorf("got group % x, want % x", cmds[0], want)
+	}
+
+	if _, err := s.refreshClockTime(now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(fifoLoads(adaptor)); got != 2 {
+		t.Errorf("got %d RDS groups after a minute, want 2", got)
+	}
+}
+
+func TestSetClockTimeFIFOFull(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	available := uint8(2)
+	adaptor.Responder = func(cmd []byte) []byte {
+		if cmd[0] != CMD_TX_RDS_BUFF || cmd[1] != 0 {
+			return nil
+		}
+		return []byte{STATUS_CTS, STATUS_CTS, 0, 20, 12, available, rdsFIFOBlocks - available}
+	}
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+	now := time.Date(2020, 1, 1, 12, 34, 56, 0, time.UTC)
+	if err := s.SetClockTime(now); !errors.Is(err, ErrRDSFIFOFull) {
+		t.Errorf("got error %v, want %v", err, ErrRDSFIFOFull)
+	}
+	overflow, err := s.refreshClockTime(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !overflow {
+		t.Error("expected the full FIFO to be reported as an overflow")
+	}
+	if got := fifoLoads(adaptor); len(got) != 0 {
+		t.Errorf("got loads % x in a full FIFO, want none", got)
+	}
+	if !s.clockTimeSent.IsZero() {
+		t.Errorf("got clock-time sent at %v, want none", s.clockTimeSent)
+	}
+
+	// sent once the FIFO has room again, in the same minute
+	available = rdsGroupBlocks
+	if _, err := s.refreshClockTime(now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if got := fifoLoads(adaptor); len(got) != 1 {
+		t.Errorf("got %d loads, want the clock-time", len(got))
+	}
+	if !s.clockTimeSent.Equal(now.Truncate(time.Minute)) {
+		t.Errorf("got clock-time sent at %v, want %v", s.clockTimeSent, now.Truncate(time.Minute))
+	}
+}
+
+func TestSetTrafficAnnouncement(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true, TrafficProgram: true})
+
+	if err := s.SetTrafficAnnouncement(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTrafficAnnouncement(false); err != nil {
+		t.Fatal(err)
+	}
+
+	got := propertyWrites(adaptor, PROP_TX_RDS_PS_MISC)
+	want := []uint16{0x1C18, 0x1C08}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got PS misc writes %#v, want %#v", got, want)
+	}
+
+	if got := s.groupB(groupTypeClockTime); got != 0x4400 {
+		t.Errorf("got block B 0x%04x, want 0x4400", got)
+	}
+}
+
+func TestSetRDSStations(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+	if err := s.SetRDSStations([]string{"DLSNIPER", "95.5 FM"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]byte{
+		{CMD_TX_RDS_PS, 0, 'D', 'L', 'S', 'N'},
+		{CMD_TX_RDS_PS, 1, 'I', 'P', 'E', 'R'},
+		{CMD_TX_RDS_PS, 2, '9', '5', '.', '5'},
+		{CMD_TX_RDS_PS, 3, ' ', 'F', 'M', ' '},
+	}
+	got := adaptor.CommandsOf(CMD_TX_RDS_PS)
+	if len(got) != len(want) {
+		t.Fatalf("got %d slot commands, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("slot %d: got % x, want % x", i, got[i], want[i])
+		}
+	}
+
+	if got := propertyWrites(adaptor, PROP_TX_RDS_MESSAGE_COUNT); len(got) != 1 || got[0] != 2 {
+		t.Errorf("got message count writes %#v, want 2", got)
+	}
+
+	invalid := [][]string{
+		nil,
+		{"DLSNIPER!"},
+		{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13"},
+	}
+	for _, names := range invalid {
+		if err := s.SetRDSStations(names); err == nil {
+			t.Errorf("expected an error for %q", names)
+		}
+	}
+}
+
+func TestSetRadioText(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+	abFlags := func() []bool {
+		var res []bool
+		for _, c := range adaptor.CommandsOf(CMD_TX_RDS_BUFF) {
+			res = append(res, c[3]&0x10 != 0)
+		}
+		adaptor.Reset()
+		return res
+	}
+
+	if err := s.SetRadioText("Now playing"); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{
+		{CMD_TX_RDS_BUFF, 0x06, 0x20, 0x00, 'N', 'o', 'w', ' '},
+		{CMD_TX_RDS_BUFF, 0x04, 0x20, 0x01, 'p', 'l', 'a', 'y'},
+		{CMD_TX_RDS_BUFF, 0x04, 0x20, 0x02, 'i', 'n', 'g', '\r'},
+	}
+	got := adaptor.CommandsOf(CMD_TX_RDS_BUFF)
+	if len(got) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("group %d: got % x, want % x", i, got[i], want[i])
+		}
+	}
+	adaptor.Reset()
+
+	steps := []struct {
+		text string
+		b    bool
+	}{
+		{text: "Next up", b: true},
+		{text: "Next up", b: true},
+		{text: "The news", b: false},
+	}
+	for _, step := range steps {
+		if err := s.SetRadioText(step.text); err != nil {
+			t.Fatal(err)
+		}
+		for i, b := range abFlags() {
+			if b != step.b {
+				t.Errorf("%q group %d: got B flag %v, want %v", step.text, i, b, step.b)
+			}
+		}
+	}
+
+	long := make([]byte, 65)
+	if err := s.SetRadioText(string(long)); err == nil {
+		t.Error("expected an error for a 65 characters text")
+	}
+}
+
+func TestRDSTextPadding(t *testing.T) {
+	const text = "ABCDEFGHI"
+
+	for length := 1; length <= len(text); length++ {
+		adaptor := radiotest.NewAdaptor(nil)
+		s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+		msg := text[:length]
+		// the last length only fits the message
+		if length <= rdsStationNameLength {
+			if err := s.SetRDSStation(msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.SetRDSMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+
+		padded := []byte(msg)
+		for len(padded)%4 != 0 {
+			padded = append(padded, ' ')
+		}
+
+		var station, message []byte
+		for _, c := range adaptor.CommandsOf(CMD_TX_RDS_PS) {
+			station = append(station, c[2:]...)
+		}
+		for _, c := range adaptor.CommandsOf(CMD_TX_RDS_BUFF) {
+			// skip the clock-time group
+			if c[2]>>4 == groupTypeRadioText {
+				message = append(message, c[4:]...)
+			}
+		}
+
+		if length <= rdsStationNameLength && !bytes.Equal(station, padded) {
+			t.Errorf("length %d: got station slots %q, want %q", length, station, padded)
+		}
+		if !bytes.Equal(message, padded) {
+			t.Errorf("length %d: got message slots %q, want %q", length, message, padded)
+		}
+	}
+}
+
+func TestRDSTextLength(t *testing.T) {
+	long := strings.Repeat("x", rdsRadioTextLength+1)
+
+	cfg := Si4713Config{TransmitFrequency: 9550, TransmitPower: 115, RDSStationName: "DLSNIPER FM", Log: t.Logf}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a 11 characters station name")
+	}
+	cfg = Si4713Config{TransmitFrequency: 9550, TransmitPower: 115, RDSMessage: long, Log: t.Logf}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a 65 characters message")
+	}
+
+	logger := &capturingLogger{}
+	cfg = Si4713Config{
+		TransmitFrequency: 9550,
+		TransmitPower:     115,
+		RDSStationName:    "DLSNIPER FM",
+		RDSMessage:        long,
+		TruncateRDSText:   true,
+		Logger:            logger,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RDSStationName != "DLSNIPER" {
+		t.Errorf("got station name %q, want %q", cfg.RDSStationName, "DLSNIPER")
+	}
+	if cfg.RDSMessage != long[:rdsRadioTextLength] {
+		t.Errorf("got a %d characters message, want %d", len(cfg.RDSMessage), rdsRadioTextLength)
+	}
+	if len(logger.info) != 2 {
+		t.Errorf("got info messages %q, want the two truncations", logger.info)
+	}
+
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+	if err := s.SetRDSStation("Ràdió Ünö"); err == nil {
+		t.Error("expected an error for a 9 characters station name")
+	}
+	if err := s.SetRDSMessage(long); err == nil {
+		t.Error("expected an error for a 65 characters message")
+	}
+	if len(adaptor.Commands()) != 0 {
+		t.Errorf("got %d commands for the rejected texts, want none", len(adaptor.Commands()))
+	}
+
+	adaptor = radiotest.NewAdaptor(nil)
+	s = newTestDriver(t, adaptor, Si4713Config{HasRDS: true, TruncateRDSText: true})
+	if err := s.SetRDSStation("Ràdió Ünö"); err != nil {
+		t.Fatal(err)
+	}
+	var station []byte
+	for _, c := range adaptor.CommandsOf(CMD_TX_RDS_PS) {
+		station = append(station, c[2:]...)
+	}
+	if want := toRDS("Ràdió Ün"); !bytes.Equal(station, want) {
+		t.Errorf("got station slots % x, want % x", station, want)
+	}
+	if err := s.SetRDSMessage(long); err != nil {
+		t.Fatal(err)
+	}
+	var loads int
+	for _, c := range adaptor.CommandsOf(CMD_TX_RDS_BUFF) {
+		if c[1]&rdsBuffLoad != 0 {
+			loads++
+		}
+	}
+	if loads != rdsRadioTextLength/4+1 {
+		t.Errorf("got %d group buffer loads, want %d and the clock-time", loads, rdsRadioTextLength/4)
+	}
+}
+
+func TestUpdateRadioText(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+	if err := s.UpdateRadioText("now playing"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := propertyWrites(adaptor, PROP_TX_COMPONENT_ENABLE); len(got) != 0 {
+		t.Errorf("got component writes %v, want none", got)
+	}
+	var message []byte
+	for _, c := range adaptor.CommandsOf(CMD_TX_RDS_BUFF) {
+		if c[2]>>4 != groupTypeRadioText {
+			t.Errorf("got group type %d, want only RadioText groups", c[2]>>4)
+			continue
+		}
+		message = append(message, c[4:]...)
+	}
+	if want := []byte("now playing "); !bytes.Equal(message, want) {
+		t.Errorf("got message slots %q, want %q", message, want)
+	}
+	if len(s.textGroups) != 3 {
+		t.Errorf("got %d pumped groups, want 3", len(s.textGroups))
+	}
+}
+
+func TestToRDS(t *testing.T) {
+	tests := []struct {
+		text string
+		want []byte
+	}{
+		{text: "Radio 1", want: []byte("Radio 1")},
+		{text: "Café", want: []byte{'C', 'a', 'f', 0x82}},
+		{text: "Müller Straße", want: []byte{'M', 0x99, 'l', 'l', 'e', 'r', ' ', 'S', 't', 'r', 'a', 0x8D, 'e'}},
+		{text: "Ångström", want: []byte{0xE1, 'n', 'g', 's', 't', 'r', 0x97, 'm'}},
+		{text: "$5 €", want: []byte{0xAB, '5', ' ', 0xA9}},
+		{text: "Hi 👋~", want: []byte{'H', 'i', ' ', '?', '?'}},
+	}
+
+	for _, tt := range tests {
+		if got := toRDS(tt.text); !bytes.Equal(got, tt.want) {
+			t.Errorf("%q: got % x, want % x", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSetRDSStationsCharset(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+	// 8 characters, even if longer than 8 bytes in UTF-8
+	if err := s.SetRDSStations([]string{"Ràdió Ü"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var name []byte
+	for _, c := range adaptor.CommandsOf(CMD_TX_RDS_PS) {
+		name = append(name, c[2:]...)
+	}
+	want := []byte{'R', 0x81, 'd', 'i', 0x86, ' ', 0xD9, ' '}
+	if !bytes.Equal(name, want) {
+		t.Errorf("got % x, want % x", name, want)
+	}
+}
+
+func TestPICodeFromCallSign(t *testing.T) {
+	tests := []struct {
+		call string
+		want uint16
+	}{
+		{call: "KAAA", want: 0x1000},
+		{call: "KZZZ", want: 0x54A7},
+		{call: "WAAA", want: 0x54A8},
+		{call: "WZZZ", want: 0x994F},
+		{call: "KABC", want: 0x101C},
+		{call: "wdet", want: 0x5D0F},
+	}
+
+	for _, tt := range tests {
+		got, err := PICodeFromCallSign(tt.call)
+		if err != nil {
+			t.Errorf("%s: %v", tt.call, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got 0x%04X, want 0x%04X", tt.call, got, tt.want)
+		}
+	}
+
+	for _, call := range []string{"", "KEX", "CBC1", "K1BC", "WABCD"} {
+		if _, err := PICodeFromCallSign(call); err == nil {
+			t.Errorf("%q: expected an error", call)
+		}
+	}
+}
+
+func TestRegion(t *testing.T) {
+	cfg := Si4713Config{
+		TransmitFrequency: 9550,
+		Region:            RegionNorthAmerica,
+		CallSign:          "KABC",
+		ProgramType:       5,
+		Log:               t.Logf,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RDSProgramID != 0x101C {
+		t.Errorf("got program ID 0x%04X, want 0x101C", cfg.RDSProgramID)
+	}
+	if got := cfg.ProgramTypeName(); got != "Rock" {
+		t.Errorf("got program type %q, want Rock", got)
+	}
+
+	cfg.Region = RegionEurope
+	if got := cfg.Region.ProgramTypeName(cfg.ProgramType); got != "Education" {
+		t.Errorf("got program type %q, want Education", got)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a call sign in Europe")
+	}
+}
+
+func TestScanBand(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_TUNE_STATUS: {STATUS_CTS, STATUS_CTS, 0, 0, 0, 0, 0, 0, 33},
+	})
+	var reported []FrequencyNoise
+	s := newTestDriver(t, adaptor, Si4713Config{OnMeasurement: func(n FrequencyNoise) {
+		reported = append(reported, n)
+	}})
+
+	noise, err := s.ScanBand(0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	measures := adaptor.CommandsOf(CMD_TX_TUNE_MEASURE)
+	if len(noise) != 206 || len(measures) != len(noise) {
+		t.Fatalf("got %d results and %d measurements, want 206", len(noise), len(measures))
+	}
+	if first, last := noise[0].FrequencyKHz, noise[len(noise)-1].FrequencyKHz; first != 8750 || last != 10800 {
+		t.Errorf("got band %d ... %d, want 8750 ... 10800", first, last)
+	}
+	if !reflect.DeepEqual(reported, noise) {
+		t.Errorf("got %d reported measurements, want the %d results", len(reported), len(noise))
+	}
+	for i, n := range noise {
+		measured := uint16(measures[i][2])<<8 | uint16(measures[i][3])
+		if n.FrequencyKHz != measured || n.NoiseLevel != 33 {
+			t.Errorf("result %d: got %+v, measured %d", i, n, measured)
+		}
+	}
+}
+
+func TestFindClearestFrequency(t *testing.T) {
+	noise := map[uint16]uint8{9550: 40, 9570: 22, 9590: 31, 9610: 22}
+
+	adaptor := radiotest.NewAdaptor(nil)
+	measured := uint16(0)
+	adaptor.Responder = func(cmd []byte) []byte {
+		switch cmd[0] {
+		case CMD_TX_TUNE_MEASURE:
+			measured = uint16(cmd[2])<<8 | uint16(cmd[3])
+		case CMD_TX_TUNE_STATUS:
+			return []byte{STATUS_CTS, STATUS_CTS, 0, 0, 0, 0, 0, 0, noise[measured]}
+		}
+		return nil
+	}
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	freq, err := s.FindClearestFrequency([]uint16{9610, 9550, 9570, 9590})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freq != 9570 {
+		t.Errorf("got %d, want 9570", freq)
+	}
+
+	if _, err := s.FindClearestFrequency(nil); err == nil {
+		t.Error("expected an error without candidates")
+	}
+
+	adaptor.Responder = func(cmd []byte) []byte { return nil }
+	adaptor.ReadImpl = func([]byte) (int, error) {
+		return 0, errors.New("bus error")
+	}
+	if _, err := s.FindClearestFrequency([]uint16{9550}); err == nil {
+		t.Error("expected the read error to be reported")
+	}
+}
+
+func TestStartClearestFrequency(t *testing.T) {
+	noise := map[uint16]uint8{9570: 22, 10210: 22, 9550: 30}
+
+	adaptor := radiotest.NewAdaptor(nil)
+	measured := uint16(0)
+	adaptor.Responder = func(cmd []byte) []byte {
+		switch cmd[0] {
+		case CMD_GET_REV:
+			return []byte{STATUS_CTS, STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3}
+		case CMD_TX_TUNE_MEASURE:
+			measured = uint16(cmd[2])<<8 | uint16(cmd[3])
+		case CMD_TX_TUNE_STATUS:
+			level, ok := noise[measured]
+			if !ok {
+				level = 50
+			}
+			return []byte{STATUS_CTS, STATUS_CTS, 0, 0, 0, 0, 0, 0, level}
+		}
+		return nil
+	}
+	s := newTestDriver(t, adaptor, Si4713Config{WithFrequencyScan: true})
+	s.TransmitFrequency = 0
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if s.TransmitFrequency != 9570 {
+		t.Errorf("got frequency %d, want 9570", s.TransmitFrequency)
+	}
+	// the band is scanned once, then the picked frequency
+	if got := len(adaptor.CommandsOf(CMD_TX_TUNE_MEASURE)); got != 207 {
+		t.Errorf("got %d measurements, want 207", got)
+	}
+}
+
+func TestScanBandRange(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	noise, err := s.ScanBand(9500, 9600, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []uint16
+	for _, n := range noise {
+		got = append(got, n.FrequencyKHz)
+	}
+	if want := []uint16{9500, 9520, 9540, 9560, 9580, 9600}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got frequencies %v, want %v", got, want)
+	}
+
+	if noise, err = s.ScanBand(9550, 9560, 20); err != nil || len(noise) != 1 || noise[0].FrequencyKHz != 9550 {
+		t.Errorf("got %+v, %v, want only 9550", noise, err)
+	}
+
+	for _, band := range [][3]uint16{{7600, 10800, 10}, {8750, 10810, 10}} {
+		if _, err := s.ScanBand(band[0], band[1], band[2]); !errors.Is(err, ErrFrequencyOutOfRange) {
+			t.Errorf("band %v: got error %v, want %v", band, err, ErrFrequencyOutOfRange)
+		}
+	}
+	if _, err := s.ScanBand(9600, 9500, 10); err == nil {
+		t.Error("expected an error for a start after the end")
+	}
+}
+
+func TestScanBandContext(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	measures := 0
+	adaptor.Responder = func(cmd []byte) []byte {
+		if cmd[0] == CMD_TX_TUNE_MEASURE {
+			measures++
+			if measures == 3 {
+				cancel()
+			}
+		}
+		return nil
+	}
+
+	noise, err := s.ScanBandContext(ctx, 0, 0, 0)
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if noise != nil || measures != 3 {
+		t.Errorf("got %d results after %d measurements, want none after 3", len(noise), measures)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{CommandTimeout: 5 * time.Millisecond, TuneTimeout: 20 * time.Millisecond})
+
+	adaptor.ReadImpl = func(buff []byte) (int, error) {
+		for i := range buff {
+			buff[i] = 0
+		}
+		return len(buff), nil
+	}
+
+	if err := s.SetTransmitPower(100); err == nil || err.Error() != "timed out waiting for CTS" {
+		t.Errorf("got error %v, want a CTS timeout", err)
+	}
+
+	// CTS is set but the tune never completes
+	adaptor.ReadImpl = func(buff []byte) (int, error) {
+		for i := range buff {
+			buff[i] = STATUS_CTS
+		}
+		return len(buff), nil
+	}
+
+	if err := s.tuneFM(context.Background(), 9550); err == nil {
+		t.Error("expected a tune timeout")
+	}
+	if err := s.readTuneMeasure(context.Background(), 9550, 0); err == nil {
+		t.Error("expected a measurement timeout")
+	}
+}
+
+func TestTuneFMReadError(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	reads := 0
+	adaptor.ReadImpl = func(buff []byte) (int, error) {
+		reads++
+		switch reads {
+		case 1:
+			// CTS for the tune command
+			buff[0] = STATUS_CTS
+		case 2:
+			// tune still in progress
+			buff[0] = STATUS_CTS
+		default:
+			return 0, errors.New("bus error")
+		}
+		return 1, nil
+	}
+
+	if err := s.tuneFM(context.Background(), 9550); err == nil || err.Error() != "bus error" {
+		t.Errorf("got error %v, want the bus error", err)
+	}
+}
+
+func TestAudioInput(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Si4713Config
+		opMode     byte
+		format     []uint16
+		sampleRate []uint16
+	}{
+		{
+			name:   "analog",
+			cfg:    Si4713Config{},
+			opMode: 0x50,
+		},
+		{
+			name:       "digital",
+			cfg:        Si4713Config{AudioInput: AudioInputDigital, DigitalFormat: 0x0001},
+			opMode:     0x0F,
+			format:     []uint16{0x0001},
+			sampleRate: []uint16{48000},
+		},
+	}
+
+	for _, tt := range tests {
+		adaptor := radiotest.NewAdaptor(nil)
+		s := newTestDriver(t, adaptor, tt.cfg)
+
+		if err := s.powerUp(); err != nil {
+			t.Fatal(err)
+		}
+
+		cmds := adaptor.CommandsOf(CMD_POWER_UP)
+		if len(cmds) != 1 || cmds[0][2] != tt.opMode {
+			t.Errorf("%s: got power up commands %#v, want mode 0x%x", tt.name, cmds, tt.opMode)
+		}
+		if got := propertyWrites(adaptor, PROP_DIGITAL_INPUT_FORMAT); fmt.Sprint(got) != fmt.Sprint(tt.format) {
+			t.Errorf("%s: got format writes %v, want %v", tt.name, got, tt.format)
+		}
+		if got := propertyWrites(adaptor, PROP_DIGITAL_INPUT_SAMPLE_RATE); fmt.Sprint(got) != fmt.Sprint(tt.sampleRate) {
+			t.Errorf("%s: got sample rate writes %v, want %v", tt.name, got, tt.sampleRate)
+		}
+	}
+
+	cfg := Si4713Config{TransmitFrequency: 9550, AudioInput: AudioInputDigital, DigitalSampleRate: 44100, Log: t.Logf}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+	cfg.DigitalSampleRate = 96
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a 96 Hz sample rate")
+	}
+}
+
+func TestRefClk(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Si4713Config
+		freq      uint16
+		prescaler uint16
+	}{
+		{name: "default", cfg: Si4713Config{}, freq: 32768, prescaler: 1},
+		{name: "custom", cfg: Si4713Config{RefClkFreq: 31250, RefClkPrescale: 0x1000 | 400}, freq: 31250, prescaler: 0x1190},
+		{name: "AFC disabled", cfg: Si4713Config{DisableAFC: true}, freq: 0, prescaler: 1},
+	}
+
+	for _, tt := range tests {
+		adaptor := radiotest.NewAdaptor(nil)
+		s := newTestDriver(t, adaptor, tt.cfg)
+
+		if err := s.powerUp(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := propertyWrites(adaptor, PROP_REFCLK_FREQ); len(got) != 1 || got[0] != tt.freq {
+			t.Errorf("%s: got frequency writes %v, want %d", tt.name, got, tt.freq)
+		}
+		if got := propertyWrites(adaptor, PROP_REFCLK_PRESCALE); len(got) != 1 || got[0] != tt.prescaler {
+			t.Errorf("%s: got prescaler writes %v, want 0x%x", tt.name, got, tt.prescaler)
+		}
+	}
+
+	for _, cfg := range []Si4713Config{{RefClkFreq: 31129}, {RefClkFreq: 34407}, {RefClkPrescale: 0x1000}, {RefClkPrescale: 0x2001}} {
+		cfg.TransmitFrequency = 9550
+		cfg.Log = t.Logf
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected an error for frequency %d and prescaler 0x%x", cfg.RefClkFreq, cfg.RefClkPrescale)
+		}
+	}
+}
+
+func TestSetAudioDeviation(t *testing.T) {
+	conversions := map[uint32]uint16{66250: 6625, 68250: 6825, 90000: 9000, 12344: 1234, 12345: 1235, 0: 0}
+	for hz, want := range conversions {
+		if got := hzToDeviation(hz); got != want {
+			t.Errorf("%d Hz: got %d, want %d", hz, got, want)
+		}
+	}
+
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{})
+	if s.AudioDeviationHz != 66250 {
+		t.Errorf("got default deviation %d, want 66250", s.AudioDeviationHz)
+	}
+
+	if err := s.SetAudioDeviation(75000); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetAudioDeviation(90001); err == nil {
+		t.Error("expected an error for 90001 Hz")
+	}
+
+	if got := propertyWrites(adaptor, PROP_TX_AUDIO_DEVIATION); len(got) != 1 || got[0] != 7500 {
+		t.Errorf("got deviation writes %v, want 7500", got)
+	}
+	if s.AudioDeviationHz != 75000 {
+		t.Errorf("got deviation %d, want 75000", s.AudioDeviationHz)
+	}
+}
+
+func TestPilotConfiguration(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	if err := s.configureAudio(); err != nil {
+		t.Fatal(err)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_PILOT_DEVIATION); len(got) != 1 || got[0] != 675 {
+		t.Errorf("got default pilot deviation writes %v, want 675", got)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_PILOT_FREQUENCY); len(got) != 1 || got[0] != 19000 {
+		t.Errorf("got default pilot frequency writes %v, want 19000", got)
+	}
+	adaptor.Reset()
+
+	if err := s.SetPilotDeviation(7500); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPilotFrequency(18950); err != nil {
+		t.Fatal(err)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_PILOT_DEVIATION); len(got) != 1 || got[0] != 750 {
+		t.Errorf("got pilot deviation writes %v, want 750", got)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_PILOT_FREQUENCY); len(got) != 1 || got[0] != 18950 {
+		t.Errorf("got pilot frequency writes %v, want 18950", got)
+	}
+
+	if err := s.SetPilotDeviation(90001); err == nil {
+		t.Error("expected an error for a 90001 Hz deviation")
+	}
+	for _, hz := range []uint16{0, 17999, 19001} {
+		if err := s.SetPilotFrequency(hz); err == nil {
+			t.Errorf("expected an error for a %d Hz pilot", hz)
+		}
+	}
+	if s.PilotDeviationHz != 7500 || s.PilotFrequencyHz != 18950 {
+		t.Errorf("got pilot deviation %d and frequency %d, want 7500 and 18950", s.PilotDeviationHz, s.PilotFrequencyHz)
+	}
+}
+
+func TestSetRDSDeviation(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+	if err := s.beginRDS(s.RDSProgramID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRDSDeviation(3500); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRDSDeviation(7501); err == nil {
+		t.Error("expected an error for 7501 Hz")
+	}
+
+	got := propertyWrites(adaptor, PROP_TX_RDS_DEVIATION)
+	if len(got) != 2 || got[0] != 200 || got[1] != 350 {
+		t.Errorf("got deviation writes %v, want [200 350]", got)
+	}
+}
+
+func TestAlternateFrequency(t *testing.T) {
+	codes := map[uint16]uint16{0: 0xE0E0, 8760: 0xE101, 9850: 0xE16E, 10790: 0xE1CC}
+	for freq, want := range codes {
+		if got := alternateFrequencyCode(freq); got != want {
+			t.Errorf("%d: got 0x%04X, want 0x%04X", freq, got, want)
+		}
+	}
+
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true, AlternateFrequency: 9850})
+	if err := s.beginRDS(s.RDSProgramID); err != nil {
+		t.Fatal(err)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_RDS_PS_AF); len(got) != 1 || got[0] != 0xE16E {
+		t.Errorf("got AF writes %v, want 98.50 MHz as 0xE16E", got)
+	}
+
+	for _, freq := range []uint16{8750, 9855, 10800} {
+		cfg := Si4713Config{TransmitFrequency: 9550, AlternateFrequency: freq, Log: t.Logf}
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.AlternateFrequency != 0 {
+			t.Errorf("%d: got alternate frequency %d, want none", freq, cfg.AlternateFrequency)
+		}
+	}
+}
+
+func TestSetAlternateFrequencies(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+	if err := s.SetAlternateFrequencies([]uint16{9850, 10110}); err != nil {
+		t.Fatal(err)
+	}
+	// two frequencies, 98.50 MHz, then 101.10 MHz and the filler
+	want := []uint16{0xE26E, 0x88CD}
+	if !reflect.DeepEqual(s.afWords, want) {
+		t.Errorf("got AF list % X, want % X", s.afWords, want)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := s.loop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := propertyWrites(adaptor, PROP_TX_RDS_PS_AF)
+	if want := []uint16{0xE26E, 0x88CD, 0xE26E}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got AF writes % X, want % X", got, want)
+	}
+
+	if got := alternateFrequencyList([]uint16{8760, 8770, 10790}); !reflect.DeepEqual(got, []uint16{0xE301, 0x02CC}) {
+		t.Errorf("got AF list % X for three frequencies", got)
+	}
+
+	if err := s.SetAlternateFrequencies(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := propertyWrites(adaptor, PROP_TX_RDS_PS_AF); got[len(got)-1] != 0xE0E0 {
+		t.Errorf("got last AF write 0x%04X, want none", got[len(got)-1])
+	}
+
+	if err := s.SetAlternateFrequencies([]uint16{9850, 8750}); err == nil {
+		t.Error("expected an error for 87.50 MHz")
+	}
+	if err := s.SetAlternateFrequencies(make([]uint16, 26)); err == nil {
+		t.Error("expected an error for 26 frequencies")
+	}
+}
+
+func TestRDSMixRatio(t *testing.T) {
+	values := map[RDSMix]uint16{
+		RDSMixHalf:          3,
+		RDSMixWhenIdle:      0,
+		RDSMixEighth:        1,
+		RDSMixQuarter:       2,
+		RDSMixThreeQuarters: 4,
+		RDSMixSevenEighths:  5,
+		RDSMixPSOnly:        6,
+	}
+	for mix, want := range values {
+		adaptor := radiotest.NewAdaptor(nil)
+		s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true, RDSMixRatio: mix})
+		if err := s.beginRDS(s.RDSProgramID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetRDSMixRatio(mix); err != nil {
+			t.Fatal(err)
+		}
+
+		got := propertyWrites(adaptor, PROP_TX_RDS_PS_MIX)
+		if len(got) != 2 || got[0] != want || got[1] != want {
+			t.Errorf("mix %d: got writes %v, want %d", mix, got, want)
+		}
+	}
+
+	s := newTestDriver(t, radiotest.NewAdaptor(nil), Si4713Config{})
+	if err := s.SetRDSMixRatio(RDSMixPSOnly + 1); err == nil {
+		t.Error("expected an error for an unknown mix ratio")
+	}
+	cfg := Si4713Config{TransmitFrequency: 9550, RDSMixRatio: RDSMixPSOnly + 1, Log: t.Logf}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for the configured unknown mix ratio")
+	}
+}
+
+func TestSetRDSPSRepeatCount(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+	if err := s.beginRDS(s.RDSProgramID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRDSPSRepeatCount(10); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []uint16{0, 256} {
+		if err := s.SetRDSPSRepeatCount(n); err == nil {
+			t.Errorf("expected an error for %d repeats", n)
+		}
+	}
+
+	got := propertyWrites(adaptor, PROP_TX_RDS_PS_REPEAT_COUNT)
+	if len(got) != 2 || got[0] != 3 || got[1] != 10 {
+		t.Errorf("got repeat count writes %v, want [3 10]", got)
+	}
+	if s.RDSPSRepeatCount != 10 {
+		t.Errorf("got configured repeat count %d, want 10", s.RDSPSRepeatCount)
+	}
+
+	cfg := Si4713Config{TransmitFrequency: 9550, RDSPSRepeatCount: 300, Log: t.Logf}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for the configured 300 repeats")
+	}
+}
+
+func TestSetLineInputLevel(t *testing.T) {
+	encodings := map[uint16]uint16{636: 0x327C, 190: 0x00BE, 191: 0x10BF, 301: 0x112D, 400: 0x2190, 417: 0x31A1}
+	for mv, want := range encodings {
+		if got := lineInputLevel(mv); got != want {
+			t.Errorf("%d mV: got 0x%04x, want 0x%04x", mv, got, want)
+		}
+	}
+
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	if err := s.SetLineInputLevel(300); err != nil {
+		t.Fatal(err)
+	}
+	for _, mv := range []uint16{0, 637} {
+		if err := s.SetLineInputLevel(mv); err == nil {
+			t.Errorf("expected an error for %d mV", mv)
+		}
+	}
+
+	if got := propertyWrites(adaptor, PROP_TX_LINE_LEVEL_INPUT_LEVEL); len(got) != 1 || got[0] != 0x112C {
+		t.Errorf("got line level writes %v, want 0x112c", got)
+	}
+}
+
+func TestApplyCompressor(t *testing.T) {
+	tests := []struct {
+		name       string
+		compressor *Compressor
+		enable     uint16
+		threshold  uint16
+		gain       uint16
+	}{
+		{name: "default", compressor: nil, enable: 0x0002, threshold: 0xFFD8, gain: 10},
+		{
+			name:       "compressor and limiter",
+			compressor: &Compressor{Enable: true, Limiter: true, ThresholdDB: -15, GainDB: 15, ReleaseTime: 2, LimiterReleaseTime: 102},
+			enable:     0x0003, threshold: 0xFFF1, gain: 15,
+		},
+		{
+			name:       "disabled",
+			compressor: &Compressor{ThresholdDB: 0, LimiterReleaseTime: 5},
+			enable:     0x0000, threshold: 0x0000, gain: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		adaptor := radiotest.NewAdaptor(nil)
+		s := newTestDriver(t, adaptor, Si4713Config{Compressor: tt.compressor})
+
+		if err := s.applyCompressor(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := propertyWrites(adaptor, PROP_TX_ACOMP_ENABLE); len(got) != 1 || got[0] != tt.enable {
+			t.Errorf("%s: got enable writes %v, want 0x%04x", tt.name, got, tt.enable)
+		}
+		if got := propertyWrites(adaptor, PROP_TX_ACOMP_THRESHOLD); len(got) != 1 || got[0] != tt.threshold {
+			t.Errorf("%s: got threshold writes %v, want 0x%04x", tt.name, got, tt.threshold)
+		}
+		if got := propertyWrites(adaptor, PROP_TX_ACOMP_GAIN); len(got) != 1 || got[0] != tt.gain {
+			t.Errorf("%s: got gain writes %v, want %d", tt.name, got, tt.gain)
+		}
+	}
+
+	invalid := []Compressor{
+		{ThresholdDB: -41, LimiterReleaseTime: 102},
+		{ThresholdDB: 1, LimiterReleaseTime: 102},
+		{AttackTime: 10, LimiterReleaseTime: 102},
+		{ReleaseTime: 5, LimiterReleaseTime: 102},
+		{GainDB: 21, LimiterReleaseTime: 102},
+		{LimiterReleaseTime: 4},
+	}
+	for _, c := range invalid {
+		c := c
+		cfg := Si4713Config{TransmitFrequency: 9550, Compressor: &c, Log: t.Logf}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
+
+func TestPowerUpProperties(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	if err := s.powerUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][2]uint16{
+		{PROP_REFCLK_FREQ, 32768},
+		{PROP_REFCLK_PRESCALE, 1},
+		{PROP_TX_PREEMPHASIS, 0},
+		{PROP_TX_ACOMP_THRESHOLD, 0xFFD8},
+		{PROP_TX_ATTACK_TIME, 0},
+		{PROP_TX_RELEASE_TIME, 4},
+		{PROP_TX_ACOMP_GAIN, 10},
+		{PROP_TX_LIMITER_RELEASE_TIME, 102},
+		{PROP_TX_ACOMP_ENABLE, 0x02},
+	}
+
+	var got [][2]uint16
+	for _, c := range adaptor.CommandsOf(CMD_SET_PROPERTY) {
+		got = append(got, [2]uint16{uint16(c[2])<<8 | uint16(c[3]), uint16(c[4])<<8 | uint16(c[5])})
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got property writes %04x, want %04x", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got property write %d as %04x, want %04x", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFadeOnHalt(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{FadeOnHalt: true, HasRDS: true, TransmitPower: 115})
+
+	if err := s.Halt(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := propertyWrites(adaptor, PROP_TX_COMPONENT_ENABLE); len(got) != 1 || got[0]&componentRDS != 0 {
+		t.Errorf("got component writes %v, want RDS turned off", got)
+	}
+
+	powers := adaptor.CommandsOf(CMD_TX_TUNE_POWER)
+	if len(powers) < 2 {
+		t.Fatalf("got %d power commands, want a ramp", len(powers))
+	}
+	last := uint8(115)
+	for _, c := range powers {
+		if c[3] >= last {
+			t.Errorf("got power %d after %d, want decreasing values", c[3], last)
+		}
+		last = c[3]
+	}
+	if last != 88 {
+		t.Errorf("got final power %d, want 88", last)
+	}
+
+	cmds := adaptor.Commands()
+	if cmds[len(cmds)-1][0] != CMD_POWER_DOWN {
+		t.Errorf("got last command 0x%02x, want power down", cmds[len(cmds)-1][0])
+	}
+}
+
+func TestHaltWithoutFade(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	if err := s.Halt(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(adaptor.Commands()) != 1 || adaptor.Commands()[0][0] != CMD_POWER_DOWN {
+		t.Errorf("got commands %v, want only power down", adaptor.Commands())
+	}
+}
+
+func TestI2CAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Si4713Config
+		options []func(i2c.Config)
+		want    int
+	}{
+		{name: "default", want: Address},
+		{name: "alternate", cfg: Si4713Config{UseAlternateAddress: true}, want: AlternativeAddress},
+		{name: "option", options: []func(i2c.Config){i2c.WithAddress(AlternativeAddress)}, want: AlternativeAddress},
+	}
+
+	for _, tt := range tests {
+		adaptor := radiotest.NewAdaptor(nil)
+		tt.cfg.TransmitFrequency = 9550
+		tt.cfg.Log = t.Logf
+		s, err := NewSi4713Driver(adaptor, tt.cfg, tt.options...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		// The adaptor doesn't answer as a Si4713, only the connection matters
+		_ = s.Start()
+
+		if adaptor.Address() != tt.want {
+			t.Errorf("%s: got address 0x%02x, want 0x%02x", tt.name, adaptor.Address(), tt.want)
+		}
+	}
+
+	_, err := NewSi4713Driver(radiotest.NewAdaptor(nil), Si4713Config{TransmitFrequency: 9550, Log: t.Logf}, i2c.WithAddress(0x42))
+	if err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
+
+func TestConcurrentSetRDSMessage(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+	const workers = 8
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			errs <- s.SetRDSMessage(fmt.Sprintf("message %d", i))
+		}(i)
+	}
+	for i := 0; i < workers; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	// each message is sent as a run of RDS buffer commands, started by the 0x06 flags
+	var run int
+	for _, c := range adaptor.CommandsOf(CMD_TX_RDS_BUFF) {
+		switch {
+		case c[1] == 0x06:
+			if run != 0 && run != 3 {
+				t.Fatalf("got an interrupted message of %d slots", run)
+			}
+			run = 1
+		case c[1] == 0x04:
+			run++
+		}
+	}
+}
+
+func TestDisableRDS(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+
+	if err := s.SetRadioText("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Halt(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := propertyWrites(adaptor, PROP_TX_COMPONENT_ENABLE); len(got) != 1 || got[0] != componentPilot|componentLMR {
+		t.Errorf("got component writes %v, want 0x%x", got, componentPilot|componentLMR)
+	}
+
+	var emptied []byte
+	for _, c := range adaptor.CommandsOf(CMD_TX_RDS_BUFF) {
+		if c[1]&rdsBuffEmpty != 0 && c[1]&rdsBuffLoad == 0 {
+			emptied = append(emptied, c[1])
+		}
+	}
+	if !bytes.Equal(emptied, []byte{rdsBuffEmpty | rdsBuffIntAck, rdsBuffFIFO | rdsBuffEmpty}) {
+		t.Errorf("got buffer flags %v, want the group buffer and the FIFO emptied", emptied)
+	}
+
+	cmds := adaptor.Commands()
+	if cmds[len(cmds)-1][0] != CMD_POWER_DOWN {
+		t.Errorf("got last command 0x%02x, want power down", cmds[len(cmds)-1][0])
+	}
+	if s.radioText != "" {
+		t.Errorf("got RadioText %q, want it cleared", s.radioText)
+	}
+}
+
+func TestReadDeviceStatus(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_RDS_BUFF: {STATUS_CTS, STATUS_CTS, 0x01, 20, 12, 4, 6},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	status, err := s.ReadDeviceStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := DeviceStatus{CircularAvailable: 20, CircularUsed: 12, FifoAvailable: 4, FifoUsed: 6, Flags: 0x01}
+	if status != want {
+		t.Errorf("got %+v, want %+v", status, want)
+	}
+
+	cmds := adaptor.CommandsOf(CMD_TX_RDS_BUFF)
+	if len(cmds) != 1 || cmds[0][1] != 0 {
+		t.Errorf("got commands %v, want a single status query", cmds)
+	}
+}
+
+func TestSetGPO(t *testing.T) {
+	for pin := 1; pin <= 3; pin++ {
+		adaptor := radiotest.NewAdaptor(nil)
+		s := newTestDriver(t, adaptor, Si4713Config{})
+
+		if err := s.SetGPO(pin, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetGPO(pin, false); err != nil {
+			t.Fatal(err)
+		}
+
+		mask := byte(1 << uint(pin))
+		if ctl := adaptor.CommandsOf(CMD_GPO_CTL); len(ctl) != 1 || ctl[0][1] != mask {
+			t.Errorf("pin %d: got control commands %v, want the pin set to output once", pin, ctl)
+		}
+		set := adaptor.CommandsOf(CMD_GPO_SET)
+		if len(set) != 2 || set[0][1] != mask || set[1][1] != 0 {
+			t.Errorf("pin %d: got level commands %v, want high then low", pin, set)
+		}
+
+		if err := s.SetGPOHighImpedance(pin); err != nil {
+			t.Fatal(err)
+		}
+		if ctl := adaptor.CommandsOf(CMD_GPO_CTL); len(ctl) != 2 || ctl[1][1] != 0 {
+			t.Errorf("pin %d: got control commands %v, want the pin in Hi-Z", pin, ctl)
+		}
+	}
+
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{})
+	if err := s.SetGPO(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetGPO(3, true); err != nil {
+		t.Fatal(err)
+	}
+	set := adaptor.CommandsOf(CMD_GPO_SET)
+	if got := set[len(set)-1][1]; got != 1<<1|1<<3 {
+		t.Errorf("got levels 0x%x, want GPO1 and GPO3 high", got)
+	}
+
+	for _, pin := range []int{0, 4} {
+		if err := s.SetGPO(pin, true); err == nil {
+			t.Errorf("expected an error for pin %d", pin)
+		}
+		if err := s.SetGPOHighImpedance(pin); err == nil {
+			t.Errorf("expected an error for pin %d", pin)
+		}
+	}
+}
+
+func TestMHzConversions(t *testing.T) {
+	tests := []struct {
+		mhz  float64
+		want uint16
+	}{
+		{mhz: 95.5, want: 9550},
+		{mhz: 95.55, want: 9555},
+		{mhz: 87.5, want: 8750},
+		{mhz: 108, want: 10800},
+		{mhz: 101.104, want: 10110},
+		{mhz: 101.105, want: 10111},
+	}
+	for _, tt := range tests {
+		got, err := MHzToRaw(tt.mhz)
+		if err != nil {
+			t.Errorf("%v MHz: %v", tt.mhz, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%v MHz: got %d, want %d", tt.mhz, got, tt.want)
+		}
+	}
+
+	for _, mhz := range []float64{87.49, 108.01, 0, -95.5} {
+		if _, err := MHzToRaw(mhz); err == nil {
+			t.Errorf("%v MHz: expected an error", mhz)
+		}
+	}
+
+	if got := RawToMHz(9555); got != 95.55 {
+		t.Errorf("got %v MHz, want 95.55", got)
+	}
+
+	cfg, err := NewSi4713Config(95.55, t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TransmitFrequency != 9555 {
+		t.Errorf("got transmit frequency %d, want 9555", cfg.TransmitFrequency)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewSi4713Config(120, t.Logf); err == nil {
+		t.Error("expected an error for 120 MHz")
+	}
+}
+
+func TestOptions(t *testing.T) {
+	s, err := NewSi4713Driver(radiotest.NewAdaptor(nil), Si4713Config{},
+		WithLog(t.Logf),
+		WithTransmitFrequency(9550),
+		WithTransmitPower(100),
+		WithRDS(0x3104, "DLSNIPER", "in the mix"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.TransmitFrequency != 9550 || s.TransmitPower != 100 {
+		t.Errorf("got %d at %d dBuV, want 9550 at 100 dBuV", s.TransmitFrequency, s.TransmitPower)
+	}
+	if !s.HasRDS || s.RDSProgramID != 0x3104 || s.RDSStationName != "DLSNIPER" || s.RDSMessage != "in the mix" {
+		t.Errorf("got RDS %v 0x%x %q %q", s.HasRDS, s.RDSProgramID, s.RDSStationName, s.RDSMessage)
+	}
+
+	// validation runs after the options, so the power is still adjusted
+	s, err = NewSi4713Driver(radiotest.NewAdaptor(nil), Si4713Config{}, WithLog(t.Logf), WithTransmitFrequency(9550), WithTransmitPower(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TransmitPower != 115 {
+		t.Errorf("got power %d, want 115", s.TransmitPower)
+	}
+
+	if _, err = NewSi4713Driver(radiotest.NewAdaptor(nil), Si4713Config{}, WithLog(t.Logf), WithTransmitFrequency(12000)); err == nil {
+		t.Error("expected an error for an out of bounds frequency")
+	}
+}
+
+func TestName(t *testing.T) {
+	s := newTestDriver(t, radiotest.NewAdaptor(nil), Si4713Config{})
+	if !strings.HasPrefix(s.Name(), "Si4713Driver-") {
+		t.Errorf("got name %q, want the default one", s.Name())
+	}
+
+	s = newTestDriver(t, radiotest.NewAdaptor(nil), Si4713Config{Name: "kitchen"})
+	if s.Name() != "kitchen" {
+		t.Errorf("got name %q, want %q", s.Name(), "kitchen")
+	}
+
+	cfg, err := LoadConfig(strings.NewReader(`{"Name": "garage", "TransmitFrequency": 9550}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "garage" {
+		t.Errorf("got configured name %q, want %q", cfg.Name, "garage")
+	}
+}
+
+func TestChannelSpacing(t *testing.T) {
+	tests := []struct {
+		freq    uint16
+		spacing uint16
+		snapped uint16
+	}{
+		{freq: 9550, spacing: 10, snapped: 9550},
+		{freq: 9555, spacing: 10, snapped: 9560},
+		{freq: 9554, spacing: 10, snapped: 9550},
+		{freq: 10790, spacing: 20, snapped: 10790},
+		{freq: 9550, spacing: 20, snapped: 9550},
+		{freq: 9560, spacing: 20, snapped: 9570},
+		{freq: 10800, spacing: 20, snapped: 10790},
+	}
+
+	for _, tt := range tests {
+		for _, snap := range []bool{false, true} {
+			logger := &capturingLogger{}
+			cfg := Si4713Config{
+				TransmitFrequency: tt.freq,
+				TransmitPower:     115,
+				ChannelSpacing:    tt.spacing,
+				SnapToChannel:     snap,
+				Logger:            logger,
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			aligned := tt.freq == tt.snapped
+			if got := len(logger.info) != 0; got == aligned {
+				t.Errorf("%d on %d: got warnings %q", tt.freq, tt.spacing, logger.info)
+			}
+			want := tt.freq
+			if snap {
+				want = tt.snapped
+			}
+			if cfg.TransmitFrequency != want {
+				t.Errorf("%d on %d, snap %v: got frequency %d, want %d", tt.freq, tt.spacing, snap, cfg.TransmitFrequency, want)
+			}
+		}
+	}
+}
+
+func TestValidateLoggers(t *testing.T) {
+	cfg := Si4713Config{TransmitFrequency: 9550}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Logger == nil {
+		t.Error("expected a Logger discarding the messages")
+	}
+
+	cfg = Si4713Config{TransmitFrequency: 9550, DebugMode: true}
+	if err := cfg.Validate(); !errors.Is(err, ErrNilLogger) {
+		t.Errorf("got error %v, want %v", err, ErrNilLogger)
+	}
+
+	if _, err := NewSi4713Driver(radiotest.NewAdaptor(nil), cfg); !errors.Is(err, ErrNilLogger) {
+		t.Errorf("got error %v, want %v", err, ErrNilLogger)
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	s := newTestDriver(t, radiotest.NewAdaptor(nil), Si4713Config{})
+	if err := s.Start(); !errors.Is(err, ErrRadioNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrRadioNotFound)
+	}
+
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_GET_REV: {STATUS_CTS, STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3},
+	})
+	s = newTestDriver(t, adaptor, Si4713Config{WithFrequencyScan: true, StopAfterFrequencyScan: true})
+	if err := s.Start(); !errors.Is(err, ErrStoppedAfterScan) {
+		t.Errorf("got error %v, want %v", err, ErrStoppedAfterScan)
+	}
 
-func NewI2cTestAdaptor() *I2CTestAdaptor {
-	val := &I2CTestAdaptor{
-		i2cConnectErr:  false,
+	if _, err := s.FindClearestFrequency([]uint16{9550, 7600}); !errors.Is(err, ErrFrequencyOutOfRange) {
+		t.Errorf("got error %v, want %v", err, ErrFrequencyOutOfRange)
+	}
+	if _, err := MHzToRaw(76); !errors.Is(err, ErrFrequencyOutOfRange) {
+		t.Errorf("got error %v, want %v", err, ErrFrequencyOutOfRange)
 	}
+	cfg := Si4713Config{TransmitFrequency: 7600}
+	if err := cfg.Validate(); !errors.Is(err, ErrFrequencyOutOfRange) {
+		t.Errorf("got error %v, want %v", err, ErrFrequencyOutOfRange)
+	}
+}
 
-	val.i2cReadImpl = func() func(t *I2CTestAdaptor, buff []byte) (int, error) {
-		getRevPassCount := 0
-		return func(t *I2CTestAdaptor, buff []byte) (int, error) {
-			switch t.lastWritten[0] {
-			case CMD_POWER_UP:
-				buff[0] = STATUS_CTS
-				return 1, nil
+type capturingLogger struct {
+	debug, info, errors []string
+}
 
-			case CMD_SET_PROPERTY:
-				buff[0] = STATUS_CTS
-				return 1, nil
+func (l *capturingLogger) Debugf(format string, v ...interface{}) {
+	l.debug = append(l.debug, fmt.Sprintf(format, v...))
+}
 
-			case CMD_TX_TUNE_POWER:
-				buff[0] = STATUS_CTS
-				return 1, nil
+func (l *capturingLogger) Infof(format string, v ...interface{}) {
+	l.info = append(l.info, fmt.Sprintf(format, v...))
+}
 
-			case CMD_TX_TUNE_FREQ:
-				buff[0] = STATUS_CTS
-				return 1, nil
+func (l *capturingLogger) Errorf(format string, v ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, v...))
+}
 
-			case CMD_GET_INT_STATUS:
-				buff[0] = 0x81
-				return 1, nil
+func TestLogger(t *testing.T) {
+	logger := &capturingLogger{}
+	s := newTestDriver(t, radiotest.NewAdaptor(nil), Si4713Config{
+		DebugMode:          true,
+		Logger:             logger,
+		TransmitPower:      120,
+		AlternateFrequency: 9000,
+	})
 
-			case CMD_TX_TUNE_STATUS:
-				buff[0] = STATUS_CTS
-				return 1, nil
+	if len(logger.info) != 1 || logger.info[0] != "Transmit power 120 > 115. Adjusting to maximum of 115.\n" {
+		t.Errorf("got info messages %q", logger.info)
+	}
 
-			case CMD_TX_TUNE_MEASURE:
-				buff[0] = STATUS_CTS
-				return 1, nil
+	if err := s.SetProperty(PROP_TX_PILOT_FREQUENCY, 19000); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.debug) == 0 || logger.debug[0] != "Set Prop 0x2107 = 0x4a38 (19000)\n" {
+		t.Errorf("got debug messages %q", logger.debug)
+	}
 
-			case CMD_TX_RDS_PS:
-				buff[0] = STATUS_CTS
-				return 1, nil
+	var printed []string
+	printf := PrintfLogger(func(format string, v ...interface{}) {
+		printed = append(printed, fmt.Sprintf(format, v...))
+	})
+	printf.Debugf("debug %d", 1)
+	printf.Infof("info %d", 2)
+	printf.Errorf("error %d", 3)
+	if len(printed) != 3 || printed[0] != "debug 1" || printed[1] != "info 2" || printed[2] != "error 3" {
+		t.Errorf("got printed messages %q", printed)
+	}
+}
 
-			case CMD_TX_RDS_BUFF:
-				buff[0] = STATUS_CTS
-				return 1, nil
+func TestStartContextCanceledDuringScan(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-			case CMD_GPO_CTL:
-				buff[0] = STATUS_CTS
-				return 1, nil
+	measures := 0
+	adaptor := radiotest.NewAdaptor(nil)
+	adaptor.Responder = func(cmd []byte) []byte {
+		switch cmd[0] {
+		case CMD_GET_REV:
+			return []byte{STATUS_CTS, STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3}
+		case CMD_TX_TUNE_MEASURE:
+			measures++
+			if measures == 10 {
+				cancel()
+			}
+		}
+		return nil
+	}
+	s := newTestDriver(t, adaptor, Si4713Config{WithFrequencyScan: true})
 
-			case CMD_TX_ASQ_STATUS:
-				buff[0] = STATUS_CTS
-				return 1, nil
+	if err := s.StartContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if measures != 10 {
+		t.Errorf("got %d measurements, want the scan stopped after 10", measures)
+	}
+	if len(adaptor.CommandsOf(CMD_TX_TUNE_FREQ)) != 0 {
+		t.Error("expected no tuning after the cancellation")
+	}
+}
 
-			case CMD_GPO_SET:
-				buff[0] = STATUS_CTS
-				return 1, nil
+func TestCommandRetries(t *testing.T) {
+	for _, tt := range []struct {
+		retries uint8
+		fail    bool
+	}{
+		{retries: 2, fail: false},
+		{retries: 1, fail: true},
+	} {
+		adaptor := radiotest.NewAdaptor(nil)
+		failures := 0
+		adaptor.WriteImpl = func(b []byte) (int, error) {
+			if failures < 2 {
+				failures++
+				return 0, errors.New("bus error")
+			}
+			return len(b), nil
+		}
+		s := newTestDriver(t, adaptor, Si4713Config{MaxRetries: tt.retries})
 
-			case CMD_GET_REV:
-				getRevPassCount++
-				buff[0] = STATUS_CTS
-				if getRevPassCount == 3 {
-					buff[0] = 13
-				}
-				return 1, nil
-			default:
-				for i := range buff {
-					buff[i] = byte(rand.Intn(2))
-				}
-				return len(buff), nil
+		err := s.SetProperty(PROP_TX_PILOT_FREQUENCY, 19000)
+		if tt.fail {
+			if err == nil || err.Error() != "bus error" {
+				t.Errorf("%d retries: got error %v, want bus error", tt.retries, err)
 			}
+			continue
 		}
-	}()
+		if err != nil {
+			t.Fatalf("%d retries: %v", tt.retries, err)
+		}
+		// the failed writes are recorded too
+		if got := propertyWrites(adaptor, PROP_TX_PILOT_FREQUENCY); !reflect.DeepEqual(got, []uint16{19000, 19000, 19000}) {
+			t.Errorf("%d retries: got writes %v, want the command sent again until it goes through", tt.retries, got)
+		}
+	}
 
-	val.i2cWriteImpl = func(t *I2CTestAdaptor, buff []byte) (int, error) {
-		t.lastWritten = make([]byte, len(buff))
-		copy(t.lastWritten, buff)
+	// timeouts are not retried
+	adaptor := radiotest.NewAdaptor(nil)
+	adaptor.ReadImpl = func(buff []byte) (int, error) {
+		for i := range buff {
+			buff[i] = 0
+		}
 		return len(buff), nil
 	}
+	s := newTestDriver(t, adaptor, Si4713Config{MaxRetries: 3, CommandTimeout: time.Millisecond})
+	if err := s.SetProperty(PROP_TX_PILOT_FREQUENCY, 19000); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if got := len(adaptor.Commands()); got != 1 {
+		t.Errorf("got %d commands, want the timeout not retried", got)
+	}
+
+	// the device may have loaded the group before the error
+	adaptor = radiotest.NewAdaptor(nil)
+	adaptor.WriteImpl = func(b []byte) (int, error) {
+		return len(b), errors.New("bus error")
+	}
+	s = newTestDriver(t, adaptor, Si4713Config{MaxRetries: 3})
+	if err := s.sendCommand(cmdRDSGroup(rdsBuffFIFO|rdsBuffLoad, 0x4000, 0, 0)); err == nil {
+		t.Fatal("expected the bus error")
+	}
+	if err := s.sendCommand(cmdPowerUp(0x50)); err == nil {
+		t.Fatal("expected the bus error")
+	}
+	if got := len(adaptor.Commands()); got != 2 {
+		t.Errorf("got %d commands, want the group load and power up not retried", got)
+	}
+	if err := s.sendCommand(cmdRDSGroup(0, 0, 0, 0)); err == nil {
+		t.Fatal("expected the bus error")
+	}
+	if got := len(adaptor.Commands()); got != 6 {
+		t.Errorf("got %d status queries, want 4 with the retries", got-2)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_TUNE_STATUS: {STATUS_CTS, STATUS_CTS, 0, 0x25, 0x4E, 0, 100, 4, 12},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	if res := s.Command("SetFrequency")(map[string]interface{}{"frequency": float64(9830)}); res != nil {
+		t.Fatalf("got %v, want no error", res)
+	}
+	if s.TransmitFrequency != 9830 {
+		t.Errorf("got frequency %d, want 9830", s.TransmitFrequency)
+	}
+	if tunes := adaptor.CommandsOf(CMD_TX_TUNE_FREQ); len(tunes) != 1 || tunes[0][2] != 0x26 || tunes[0][3] != 0x66 {
+		t.Errorf("got tune commands %v, want 98.30 MHz", tunes)
+	}
+
+	if res := s.Command("SetPower")(map[string]interface{}{"power": float64(100)}); res != nil {
+		t.Fatalf("got %v, want no error", res)
+	}
+	if s.TransmitPower != 100 {
+		t.Errorf("got power %d, want 100", s.TransmitPower)
+	}
+
+	if res := s.Command("SetRDSMessage")(map[string]interface{}{"message": "hello"}); res != nil {
+		t.Fatalf("got %v, want no error", res)
+	}
+
+	res := s.Command("TuneStatus")(nil)
+	want := TuneStatus{FrequencyKHz: 9550, PowerDBuV: 100, AntennaCap: 4, NoiseLevel: 12}
+	if res != want {
+		t.Errorf("got %+v, want %+v", res, want)
+	}
+
+	for _, params := range []map[string]interface{}{
+		{},
+		{"frequency": "9550"},
+		{"frequency": float64(95.5)},
+		{"frequency": float64(120000)},
+		{"frequency": float64(12000)},
+	} {
+		if err, ok := s.Command("SetFrequency")(params).(error); !ok || err == nil {
+			t.Errorf("params %v: expected an error", params)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s := newTestDriver(t, radiotest.NewAdaptor(nil), Si4713Config{})
+	events := s.Subscribe()
+	defer s.Unsubscribe(events)
+
+	next := func() *gobot.Event {
+		select {
+		case evt := <-events:
+			return evt
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+			return nil
+		}
+	}
+
+	if err := s.SetTransmitFrequency(12000); err == nil {
+		t.Fatal("expected an error for 120 MHz")
+	}
+	if err := s.SetTransmitFrequency(9830); err != nil {
+		t.Fatal(err)
+	}
+	if evt := next(); evt.Name != EventTuned || evt.Data != uint16(9830) {
+		t.Errorf("got event %q %v, want %q 9830", evt.Name, evt.Data, EventTuned)
+	}
+
+	if err := s.SetTransmitPower(100); err != nil {
+		t.Fatal(err)
+	}
+	if evt := next(); evt.Name != EventPowerChanged || evt.Data != uint8(100) {
+		t.Errorf("got event %q %v, want %q 100", evt.Name, evt.Data, EventPowerChanged)
+	}
+
+	if err := s.UpdateRadioText("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if evt := next(); evt.Name != EventRDSUpdated || evt.Data != "hello" {
+		t.Errorf("got event %q %v, want %q hello", evt.Name, evt.Data, EventRDSUpdated)
+	}
+
+	s.notifyAudioQuality(AudioQuality{Flags: asqLow})
+	if evt := next(); evt.Name != EventSilenceDetected {
+		t.Errorf("got event %q, want %q", evt.Name, EventSilenceDetected)
+	}
+
+	if _, ok := s.Events()[EventTuned]; !ok {
+		t.Errorf("got events %v, want %q registered", s.Events(), EventTuned)
+	}
+}
+
+func TestValidateProgramID(t *testing.T) {
+	logger := &capturingLogger{}
+	cfg := Si4713Config{TransmitFrequency: 9550, TransmitPower: 115, AlternateFrequency: 9000, HasRDS: true, Logger: logger}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RDSProgramID != DefaultRDSProgramID {
+		t.Errorf("got program ID 0x%04X, want the default 0x%04X", cfg.RDSProgramID, DefaultRDSProgramID)
+	}
+	if len(logger.info) != 1 || logger.info[0] != "RDS program ID not set, defaulting to 0x3104\n" {
+		t.Errorf("got info messages %q", logger.info)
+	}
+
+	cfg = Si4713Config{TransmitFrequency: 9550, HasRDS: true, RequireRDSProgramID: true, Log: t.Logf}
+	if err := cfg.Validate(); !errors.Is(err, ErrNoProgramID) {
+		t.Errorf("got error %v, want %v", err, ErrNoProgramID)
+	}
+
+	cfg = Si4713Config{TransmitFrequency: 9550, HasRDS: true, RequireRDSProgramID: true, RDSProgramID: 0xC201, Log: t.Logf}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RDSProgramID != 0xC201 {
+		t.Errorf("got program ID 0x%04X, want 0xC201", cfg.RDSProgramID)
+	}
+}
+
+func TestScanOnly(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_GET_REV:        {STATUS_CTS, STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3},
+		CMD_TX_TUNE_STATUS: {STATUS_CTS, STATUS_CTS, 0, 0, 0, 0, 0, 0, 27},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	noise, err := s.ScanOnly()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(noise) != 206 {
+		t.Fatalf("got %d results, want 206", len(noise))
+	}
+	if noise[0] != (FrequencyNoise{FrequencyKHz: 8750, NoiseLevel: 27}) {
+		t.Errorf("got first result %+v, want 87.50 MHz at 27 dBuV", noise[0])
+	}
+	if got := adaptor.CommandsOf(CMD_POWER_UP); len(got) != 1 {
+		t.Errorf("got %d power up commands, want 1", len(got))
+	}
+	if got := adaptor.CommandsOf(CMD_TX_TUNE_FREQ); len(got) != 0 {
+		t.Errorf("got %d tune commands, want no transmission", len(got))
+	}
+
+	s = newTestDriver(t, radiotest.NewAdaptor(nil), Si4713Config{})
+	if _, err := s.ScanOnly(); !errors.Is(err, ErrRadioNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrRadioNotFound)
+	}
+}
+
+func TestRDSOverflow(t *testing.T) {
+	// the FIFO has no room left for the clock-time group
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_RDS_BUFF: {STATUS_CTS, STATUS_CTS, rdsIntFIFOXmit, 20, 12, 2, rdsFIFOBlocks - 2},
+	})
+	overflows := make(chan struct{}, 10)
+	onOverflow := func() {
+		select {
+		case overflows <- struct{}{}:
+		default:
+		}
+	}
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true, OnRDSOverflow: onOverflow})
+
+	if err := s.Loop(); err != nil {
+		t.Fatal(err)
+	}
+	if len(overflows) != 1 {
+		t.Errorf("got %d overflow calls, want 1", len(overflows))
+	}
+	if got := fifoLoads(adaptor); len(got) != 0 {
+		t.Errorf("got loads % x in a full FIFO, want none", got)
+	}
+
+	// the pump reports them too, without the Loop
+	<-overflows
+	s.textGroups = [][3]uint16{{0x2000, 0x6869, 0x0D20}, {0x2001, 0x2020, 0x2020}}
+	adaptor.Responses[CMD_TX_RDS_BUFF] = []byte{STATUS_CTS, STATUS_CTS, 0, 20, 12, 4, 2}
+	stop := s.StartRDSPump(time.Millisecond)
+	select {
+	case <-overflows:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pump overflow call")
+	}
+	stop()
+	if got := fifoLoads(adaptor); len(got) != 0 {
+		t.Errorf("got loads % x in a full FIFO, want none", got)
+	}
+
+	// no calls when the groups fit
+	adaptor = radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_RDS_BUFF: {STATUS_CTS, STATUS_CTS, rdsIntFIFOEmpty, 20, 12, rdsFIFOBlocks, 0},
+	})
+	var calls int
+	s = newTestDriver(t, adaptor, Si4713Config{HasRDS: true, OnRDSOverflow: func() { calls++ }})
+	if err := s.Loop(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("got %d overflow calls, want none", calls)
+	}
+	if got := fifoLoads(adaptor); len(got) != 1 {
+		t.Errorf("got %d loads, want the clock-time", len(got))
+	}
+}
+
+func TestRDSCircularWrap(t *testing.T) {
+	// the circular buffer wraps on each pass of the repeated groups
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_RDS_BUFF: {STATUS_CTS, STATUS_CTS, rdsIntCircularWrap, 20, 12, rdsFIFOBlocks, 0},
+	})
+	var calls int
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true, OnRDSOverflow: func() { calls++ }})
+	if err := s.SetRadioText("hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if _, err := s.refreshClockTime(now); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := s.refillRDS(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Loop(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("got %d overflow calls for the wraps, want none", calls)
+	}
+
+	var acks int
+	for _, c := range adaptor.CommandsOf(CMD_TX_RDS_BUFF) {
+		if c[1] == rdsBuffIntAck {
+			acks++
+		}
+	}
+	if acks == 0 {
+		t.Error("expected the wraps to be acknowledged")
+	}
+}
+
+func TestRDSPump(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	// the FIFO drains from 20 used blocks to 3, then gets refilled
+	used := []uint8{20, 3}
+	refilled := make(chan struct{}, 10)
+	adaptor.Responder = func(cmd []byte) []byte {
+		if cmd[0] != CMD_TX_RDS_BUFF {
+			return nil
+		}
+		switch {
+		case cmd[1] == 0:
+			fifoUsed := uint8(20)
+			if len(used) > 0 {
+				fifoUsed, used = used[0], used[1:]
+			}
+			return []byte{STATUS_CTS, STATUS_CTS, 0, 20, 12, 32 - fifoUsed, fifoUsed}
+		case cmd[1]&rdsBuffFIFO != 0:
+			refilled <- struct{}{}
+		}
+		return nil
+	}
+	s := newTestDriver(t, adaptor, Si4713Config{})
+	if err := s.SetRadioText("hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := s.StartRDSPump(time.Millisecond)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-refilled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the FIFO refill")
+		}
+	}
+	// a few more checks with the FIFO full again
+	time.Sleep(10 * time.Millisecond)
+	stop()
+	stop()
+
+	var refills [][]byte
+	for _, c := range adaptor.CommandsOf(CMD_TX_RDS_BUFF) {
+		if c[1]&rdsBuffFIFO != 0 {
+			refills = append(refills, c)
+		}
+	}
+	want := [][]byte{
+		{CMD_TX_RDS_BUFF, rdsBuffFIFO | rdsBuffLoad, 0x20, 0x00, 'h', 'e', 'l', 'l'},
+		{CMD_TX_RDS_BUFF, rdsBuffFIFO | rdsBuffLoad, 0x20, 0x01, 'o', '\r', ' ', ' '},
+	}
+	if !reflect.DeepEqual(refills, want) {
+		t.Errorf("got refills % X, want % X", refills, want)
+	}
+}
+
+func TestRDSFIFOSize(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{HasRDS: true})
+	if err := s.beginRDS(0x3104); err != nil {
+		t.Fatal(err)
+	}
+
+	// the written value is one larger than the FIFO size, 0 would disable it
+	sizes := propertyWrites(adaptor, PROP_TX_RDS_FIFO_SIZE)
+	if len(sizes) != 1 || sizes[0] != rdsFIFOBlocks+1 {
+		t.Fatalf("got FIFO size writes %v, want %d", sizes, rdsFIFOBlocks+1)
+	}
+
+	// the longest RadioText refilled by the pump fits with the clock-time group
+	if err := s.SetRadioText(strings.Repeat("x", rdsRadioTextLength)); err != nil {
+		t.Fatal(err)
+	}
+	if blocks := (len(s.textGroups) + 1) * rdsGroupBlocks; int(sizes[0]-1) < blocks {
+		t.Errorf("got a FIFO of %d blocks, want at least %d", sizes[0]-1, blocks)
+	}
+}
+
+func TestAntennaCap(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_TUNE_STATUS: {STATUS_CTS, STATUS_CTS, 0, 0x25, 0x4E, 0, 115, 42, 0},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{TransmitPower: 115, AntennaCap: 30})
+
+	if err := s.SetTransmitPower(100); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetAntennaCap(42); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetAntennaCap(192); err == nil {
+		t.Error("expected an error for capacitor 192")
+	}
+
+	cmds := adaptor.CommandsOf(CMD_TX_TUNE_POWER)
+	want := [][]byte{{CMD_TX_TUNE_POWER, 0, 0, 100, 30}, {CMD_TX_TUNE_POWER, 0, 0, 100, 42}}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("got power commands % X, want % X", cmds, want)
+	}
+	if s.AntennaCap != 42 {
+		t.Errorf("got configured capacitor %d, want 42", s.AntennaCap)
+	}
 
-	return val
+	status, err := s.GetTuneStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.AntennaCap != 42 {
+		t.Errorf("got reported capacitor %d, want 42", status.AntennaCap)
+	}
+
+	cfg := Si4713Config{TransmitFrequency: 9550, AntennaCap: 200, Log: t.Logf}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for the configured capacitor 200")
+	}
+}
+
+func TestMeasureNoise(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	measured := uint16(0)
+	adaptor.Responder = func(cmd []byte) []byte {
+		switch cmd[0] {
+		case CMD_TX_TUNE_MEASURE:
+			measured = uint16(cmd[2])<<8 | uint16(cmd[3])
+		case CMD_TX_TUNE_STATUS:
+			return []byte{STATUS_CTS, STATUS_CTS, 0, 0, 0, 0, 0, 0, uint8(measured - 9500)}
+		}
+		return nil
+	}
+	s := newTestDriver(t, adaptor, Si4713Config{})
+
+	for freq, want := range map[uint16]uint8{9550: 50, 9553: 50, 9559: 55, 9560: 60} {
+		noise, err := s.MeasureNoise(freq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if noise != want {
+			t.Errorf("%d: got noise %d, want %d", freq, noise, want)
+		}
+	}
+
+	for _, freq := range []uint16{7590, 10805} {
+		if _, err := s.MeasureNoise(freq); err == nil {
+			t.Errorf("expected an error for frequency %d", freq)
+		}
+	}
+
+	for _, c := range adaptor.CommandsOf(CMD_TX_TUNE_MEASURE) {
+		if c[4] != 0 {
+			t.Errorf("got antenna capacitor %d, want 0 for the automatic tuning", c[4])
+		}
+	}
+	if _, err := s.MeasureNoiseWithAntennaCap(9550, 120); err != nil {
+		t.Fatal(err)
+	}
+	measures := adaptor.CommandsOf(CMD_TX_TUNE_MEASURE)
+	if got := measures[len(measures)-1]; got[4] != 120 {
+		t.Errorf("got command % x, want antenna capacitor 120", got)
+	}
+	if _, err := s.MeasureNoiseWithAntennaCap(9550, 192); err == nil {
+		t.Error("expected an error for antenna capacitor 192")
+	}
+}
+
+func TestReset(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{})
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"29=1", "29=0", "29=1"}; !reflect.DeepEqual(adaptor.PinWrites(), want) {
+		t.Errorf("got pin writes %v, want %v", adaptor.PinWrites(), want)
+	}
+	if len(adaptor.Commands()) != 0 {
+		t.Errorf("got commands %v, want none", adaptor.Commands())
+	}
+
+	// the connector only has the i2c capability
+	connector := struct{ i2c.Connector }{radiotest.NewAdaptor(nil)}
+	s, err := NewSi4713Driver(connector, Si4713Config{TransmitFrequency: 9550, Log: t.Logf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reset(); !errors.Is(err, ErrNoDigitalWriter) {
+		t.Errorf("got error %v, want %v", err, ErrNoDigitalWriter)
+	}
+}
+
+func TestWithSleep(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	clock := &fakeClock{}
+	s, err := NewSi4713Driver(adaptor, Si4713Config{TransmitFrequency: 9550, FadeOnHalt: true, TransmitPower: 115, Log: t.Logf}, WithSleep(clock.sleep))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.conn = adaptor
+
+	start := time.Now()
+	if err := s.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= fadeStepDelay {
+		t.Errorf("halt took %v, want no real waits", elapsed)
+	}
+
+	// Every fade step but the final one waits before the next.
+	steps := len(adaptor.CommandsOf(CMD_TX_TUNE_POWER)) - 1
+	var fades int
+	for _, d := range clock.sleeps() {
+		if d == fadeStepDelay {
+			fades++
+		}
+	}
+	if fades != steps {
+		t.Errorf("got %d fade waits in %v, want %d", fades, clock.sleeps(), steps)
+	}
+}
+
+func TestSettleDelay(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_GET_REV: {STATUS_CTS, STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3},
+	})
+	var settled []byte
+	clock := &fakeClock{}
+	sleep := func(ctx context.Context, d time.Duration) error {
+		if d == 40*time.Millisecond {
+			// the last command before the wait
+			settled = append(settled, adaptor.LastCommand()[0])
+		}
+		return clock.sleep(ctx, d)
+	}
+	cfg := Si4713Config{TransmitFrequency: 9550, TransmitPower: 115, SettleDelay: 40 * time.Millisecond, Log: t.Logf}
+	s, err := NewSi4713Driver(adaptor, cfg, WithSleep(sleep))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(settled, []byte{CMD_TX_TUNE_POWER}) {
+		t.Errorf("got settle delays after commands % x, want once after the power", settled)
+	}
+	if got := adaptor.CommandsOf(CMD_TX_TUNE_FREQ); len(got) != 1 {
+		t.Errorf("got %d tune commands, want 1 after the delay", len(got))
+	}
+
+	// no delay by default
+	adaptor = radiotest.NewAdaptor(map[byte][]byte{
+		CMD_GET_REV: {STATUS_CTS, STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3},
+	})
+	clock = &fakeClock{}
+	cfg.SettleDelay = 0
+	if s, err = NewSi4713Driver(adaptor, cfg, WithSleep(clock.sleep)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range clock.sleeps() {
+		if d != s.ResetPulse {
+			t.Errorf("got sleep %v, want only the reset pulses", d)
+		}
+	}
+
+	cfg.SettleDelay = 2 * time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a 2s settle delay")
+	}
 }
 
+func TestResetPulse(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	s := newTestDriver(t, adaptor, Si4713Config{ResetPulse: 250 * time.Millisecond})
+
+	var slept []time.Duration
+	s.sleepFunc = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{250 * time.Millisecond, 250 * time.Millisecond}; !reflect.DeepEqual(slept, want) {
+		t.Errorf("got sleeps %v, want %v", slept, want)
+	}
+
+	cfg := Si4713Config{TransmitFrequency: 9550, Log: t.Logf}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ResetPulse != 10*time.Millisecond {
+		t.Errorf("got default reset pulse %v, want 10ms", cfg.ResetPulse)
+	}
+	cfg = Si4713Config{TransmitFrequency: 9550, ResetPulse: 2 * time.Second, Log: t.Logf}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a 2s reset pulse")
+	}
+}
@@ -0,0 +1,33 @@
+package radiotest_test
+
+import (
+	"fmt"
+	"log"
+
+	"fmradio/radio"
+	"fmradio/radio/radiotest"
+)
+
+func ExampleAdaptor() {
+	// The driver checks the part number, 13, of the GET_REV response
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		radio.CMD_GET_REV: {radio.STATUS_CTS, radio.STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3},
+	})
+
+	cfg, err := radio.NewSi4713Config(95.5, func(string, ...interface{}) {})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s, err := radio.NewSi4713Driver(adaptor, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := s.Start(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("started at address 0x%02X\n", adaptor.Address())
+
+	// Output: started at address 0x63
+}
@@ -0,0 +1,262 @@
+// Package radiotest provides an i2c adaptor to test the code using the
+// radio driver without a Si4713 breakout board.
+package radiotest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"gobot.io/x/gobot/drivers/i2c"
+)
+
+// DefaultStatus is read when there is no response for the last command:
+// CTS with the STC interrupt set, so that the driver commands and tuning complete.
+const DefaultStatus = 0x81
+
+// ErrConnect is returned by GetConnection when the adaptor is set to fail.
+var ErrConnect = errors.New("invalid i2c connection")
+
+// Adaptor is a gobot i2c adaptor replying to each command written to it,
+// by default with the canned Responses registered for the command byte.
+// Once those are consumed, or if the command has none, every read returns
+// DefaultStatus.
+// Setting Responder, ReadImpl or WriteImpl replaces the default behavior.
+// They are called without the adaptor locked, so they can use its methods.
+type Adaptor struct {
+	// Responses are the bytes read after a command, by command byte
+	Responses map[byte][]byte
+
+	// Responder returns the bytes read after the command, instead of Responses
+	Responder func(cmd []byte) []byte
+
+	// ReadImpl and WriteImpl replace the reads and writes on the connection
+	ReadImpl  func(b []byte) (int, error)
+	WriteImpl func(b []byte) (int, error)
+
+	// ConnectError makes GetConnection fail
+	ConnectError bool
+
+	name      string
+	address   int
+	written   []byte
+	commands  [][]byte
+	pending   []byte
+	pinWrites []string
+	mtx       sync.Mutex
+}
+
+// NewAdaptor creates an adaptor replying with the responses.
+func NewAdaptor(responses map[byte][]byte) *Adaptor {
+	return &Adaptor{Responses: responses}
+}
+
+// Written returns all the bytes written to the adaptor.
+func (a *Adaptor) Written() []byte {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return append([]byte(nil), a.written...)
+}
+
+// Commands returns the commands written to the adaptor, one per write.
+func (a *Adaptor) Commands() [][]byte {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	res := make([][]byte, len(a.commands))
+	for i, cmd := range a.commands {
+		res[i] = append([]byte(nil), cmd...)
+	}
+	return res
+}
+
+// CommandsOf returns the commands of the given type written to the adaptor.
+func (a *Adaptor) CommandsOf(cmd byte) [][]byte {
+	var res [][]byte
+	for _, c := range a.Commands() {
+		if c[0] == cmd {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// LastCommand returns the last command written to the adaptor, or nil if none was.
+func (a *Adaptor) LastCommand() []byte {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if len(a.commands) == 0 {
+		return nil
+	}
+	return append([]byte(nil), a.commands[len(a.commands)-1]...)
+}
+
+// PinWrites returns the digital writes, as "pin=level".
+func (a *Adaptor) PinWrites() []string {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return append([]string(nil), a.pinWrites...)
+}
+
+// Address returns the address of the last GetConnection call.
+func (a *Adaptor) Address() int {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.address
+}
+
+// Reset forgets the bytes and pins written so far and the pending response.
+func (a *Adaptor) Reset() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.written = nil
+	a.commands = nil
+	a.pending = nil
+	a.pinWrites = nil
+}
+
+// DigitalWrite records the writes to the reset pin.
+func (a *Adaptor) DigitalWrite(pin string, level byte) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.pinWrites = append(a.pinWrites, fmt.Sprintf("%s=%d", pin, level))
+	return nil
+}
+
+// Read reads the pending response.
+func (a *Adaptor) Read(b []byte) (int, error) {
+	return a.read(b)
+}
+
+// Write records the command and prepares its response.
+func (a *Adaptor) Write(b []byte) (int, error) {
+	return a.write(b)
+}
+
+func (a *Adaptor) read(b []byte) (int, error) {
+	a.mtx.Lock()
+	if readImpl := a.ReadImpl; readImpl != nil {
+		a.mtx.Unlock()
+		return readImpl(b)
+	}
+	defer a.mtx.Unlock()
+
+	for i := range b {
+		if len(a.pending) == 0 {
+			b[i] = DefaultStatus
+			continue
+		}
+		b[i], a.pending = a.pending[0], a.pending[1:]
+	}
+	return len(b), nil
+}
+
+func (a *Adaptor) write(b []byte) (int, error) {
+	a.mtx.Lock()
+	a.written = append(a.written, b...)
+	if len(b) == 0 {
+		a.mtx.Unlock()
+		return 0, nil
+	}
+
+	cmd := append([]byte(nil), b...)
+	a.commands = append(a.commands, cmd)
+	writeImpl, responder, response := a.WriteImpl, a.Responder, a.Responses[cmd[0]]
+	a.mtx.Unlock()
+
+	if writeImpl != nil {
+		return writeImpl(b)
+	}
+
+	pending := append([]byte(nil), response...)
+	if responder != nil {
+		pending = responder(append([]byte(nil), cmd...))
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.pending = pending
+	return len(b), nil
+}
+
+// Close closes the connection.
+func (a *Adaptor) Close() error {
+	return nil
+}
+
+// ReadByte reads a byte of the pending response.
+func (a *Adaptor) ReadByte() (byte, error) {
+	b := []byte{0}
+	if _, err := a.read(b); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// ReadByteData reads a byte of the pending response, ignoring the register.
+func (a *Adaptor) ReadByteData(uint8) (uint8, error) {
+	return a.ReadByte()
+}
+
+// ReadWordData reads a little endian word of the pending response, ignoring the register.
+func (a *Adaptor) ReadWordData(uint8) (uint16, error) {
+	b := []byte{0, 0}
+	if _, err := a.read(b); err != nil {
+		return 0, err
+	}
+	return uint16(b[1])<<8 | uint16(b[0]), nil
+}
+
+// WriteByte writes a single byte command.
+func (a *Adaptor) WriteByte(val byte) error {
+	_, err := a.Write([]byte{val})
+	return err
+}
+
+// WriteByteData writes the register and the byte as a command.
+func (a *Adaptor) WriteByteData(reg uint8, val uint8) error {
+	_, err := a.Write([]byte{reg, val})
+	return err
+}
+
+// WriteWordData writes the register and the little endian word as a command.
+func (a *Adaptor) WriteWordData(reg uint8, val uint16) error {
+	_, err := a.Write([]byte{reg, uint8(val), uint8(val >> 8)})
+	return err
+}
+
+// WriteBlockData writes the register and the bytes as a command.
+func (a *Adaptor) WriteBlockData(reg uint8, b []byte) error {
+	_, err := a.Write(append([]byte{reg}, b...))
+	return err
+}
+
+// GetConnection returns the adaptor itself as the connection to the device.
+func (a *Adaptor) GetConnection(address, _ int) (i2c.Connection, error) {
+	if a.ConnectError {
+		return nil, ErrConnect
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.address = address
+	return a, nil
+}
+
+// GetDefaultBus returns the bus 0.
+func (a *Adaptor) GetDefaultBus() int {
+	return 0
+}
+
+// Name of the adaptor
+func (a *Adaptor) Name() string { return a.name }
+
+// SetName sets the name of the adaptor
+func (a *Adaptor) SetName(n string) { a.name = n }
+
+// Connect does nothing, there is no hardware
+func (a *Adaptor) Connect() error { return nil }
+
+// Finalize does nothing, there is no hardware
+func (a *Adaptor) Finalize() error { return nil }
@@ -0,0 +1,81 @@
+package radiotest_test
+
+import (
+	"bytes"
+	"testing"
+
+	"fmradio/radio"
+	"fmradio/radio/radiotest"
+)
+
+func TestPowerUpSequence(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		radio.CMD_GET_REV: {radio.STATUS_CTS, radio.STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3},
+	})
+	cfg, err := radio.NewSi4713Config(95.5, t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := radio.NewSi4713Driver(adaptor, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// power up with the analog input, then the reference clock and pre-emphasis
+	want := [][]byte{
+		{radio.CMD_POWER_UP, 0x12, 0x50},
+		{radio.CMD_SET_PROPERTY, 0, 0x02, 0x01, 0x80, 0x00},
+		{radio.CMD_SET_PROPERTY, 0, 0x02, 0x02, 0x00, 0x01},
+		{radio.CMD_SET_PROPERTY, 0, 0x21, 0x06, 0x00, 0x00},
+	}
+	cmds := adaptor.Commands()
+	if len(cmds) < len(want) {
+		t.Fatalf("got %d commands, want at least %d", len(cmds), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(cmds[i], want[i]) {
+			t.Errorf("command %d: got % X, want % X", i, cmds[i], want[i])
+		}
+	}
+
+	if got := adaptor.CommandsOf(radio.CMD_GET_REV); len(got) != 1 {
+		t.Errorf("got %d GET_REV commands, want 1", len(got))
+	}
+	tune := adaptor.CommandsOf(radio.CMD_TX_TUNE_FREQ)
+	if len(tune) != 1 || !bytes.Equal(tune[0], []byte{radio.CMD_TX_TUNE_FREQ, 0, 0x25, 0x4E}) {
+		t.Errorf("got tune commands % X, want 95.50 MHz", tune)
+	}
+	if got, want := adaptor.LastCommand(), []byte{radio.CMD_GPO_CTL, 0x06}; !bytes.Equal(got, want) {
+		t.Errorf("got last command % X, want % X", got, want)
+	}
+
+	adaptor.Reset()
+	if got := adaptor.LastCommand(); got != nil {
+		t.Errorf("got last command % X after reset, want none", got)
+	}
+}
+
+func TestImplUsesAdaptor(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(nil)
+	adaptor.WriteImpl = func(b []byte) (int, error) {
+		// the adaptor is not locked while the implementations run
+		if got := adaptor.Commands(); len(got) != 1 || !bytes.Equal(got[0], b) {
+			t.Errorf("got commands % X, want % X", got, b)
+		}
+		return len(b), nil
+	}
+	adaptor.ReadImpl = func(b []byte) (int, error) {
+		b[0] = adaptor.LastCommand()[0]
+		return 1, nil
+	}
+
+	if _, err := adaptor.Write([]byte{radio.CMD_GET_REV}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := adaptor.ReadByte(); err != nil || got != radio.CMD_GET_REV {
+		t.Errorf("got 0x%02X, %v, want 0x%02X", got, err, radio.CMD_GET_REV)
+	}
+}
@@ -0,0 +1,227 @@
+package radio
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RDS group type codes, sent in the upper 4 bits of block B.
+const (
+	// groupTypeRadioText is the RadioText group, 2A
+	groupTypeRadioText = 0x2
+
+	// groupTypeClockTime is the clock-time and date group, 4A
+	groupTypeClockTime = 0x4
+)
+
+// Flags of the CMD_TX_RDS_BUFF command.
+const (
+	// rdsBuffIntAck clears the RDS interrupt status bits.
+	rdsBuffIntAck = 1 << 0
+
+	// rdsBuffEmpty empties the circular buffer before loading the group.
+	rdsBuffEmpty = 1 << 1
+
+	// rdsBuffLoad loads the group in the circular buffer, or the FIFO.
+	rdsBuffLoad = 1 << 2
+
+	// rdsBuffFIFO sends the group through the FIFO rather than the circular buffer.
+	rdsBuffFIFO = 1 << 7
+)
+
+// RDS interrupt flags, RDSINTS, of the CMD_TX_RDS_BUFF response.
+const (
+	// rdsIntFIFOEmpty is set when the FIFO got empty, FIFOMT.
+	rdsIntFIFOEmpty = 1 << 0
+
+	// rdsIntCircularWrap is set each time the circular buffer was fully
+	// transmitted, CBUFWRAP, as expected for the repeated groups.
+	rdsIntCircularWrap = 1 << 1
+
+	// rdsIntFIFOXmit is set when a FIFO group was transmitted, FIFOXMIT.
+	rdsIntFIFOXmit = 1 << 2
+
+	// rdsIntCircularXmit is set when a circular buffer group was transmitted, CBUFXMIT.
+	rdsIntCircularXmit = 1 << 3
+
+	// rdsIntPSXmit is set when a PS group was transmitted, RDSPSXMIT.
+	rdsIntPSXmit = 1 << 4
+)
+
+// mjdUnixEpoch is the Modified Julian Date of 1970-01-01.
+const mjdUnixEpoch = 40587
+
+// groupB builds the block B of a version A group with the configured
+// traffic program flag and program type.
+// The lower 5 bits are left for the group specific data.
+func (s *Si4713Driver) groupB(groupType uint16) uint16 {
+	res := groupType<<12 | uint16(s.ProgramType&0x1F)<<psMiscPTYShift
+	if s.TrafficProgram {
+		res |= psMiscTP
+	}
+	return res
+}
+
+// modifiedJulianDate computes the Modified Julian Date of the UTC date of t.
+func modifiedJulianDate(t time.Time) uint32 {
+	y, m, d := t.UTC().Date()
+	days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60)
+	return uint32(days + mjdUnixEpoch)
+}
+
+// clockTimeBlocks encodes t as the data of a 4A clock-time group.
+// It returns the 2 bits to be set in block B, then blocks C and D.
+// The time is sent in UTC along with the local offset of t, in half hours.
+func clockTimeBlocks(t time.Time) (b, c, d uint16) {
+	mjd := modifiedJulianDate(t)
+	utc := t.UTC()
+	hour := uint16(utc.Hour())
+	minute := uint16(utc.Minute())
+
+	_, offset := t.Zone()
+	var sign uint16
+	if offset < 0 {
+		sign = 1
+		offset = -offset
+	}
+	halfHours := uint16(offset/1800) & 0x1F
+
+	b = uint16(mjd>>15) & 0x3
+	c = uint16(mjd&0x7FFF)<<1 | hour>>4
+	d = (hour&0xF)<<12 | minute<<6 | sign<<5 | halfHours
+	return b, c, d
+}
+
+// rdsCharset maps the characters which are not encoded as in ASCII
+// to the basic RDS character repertoire, as listed in Annex E of the
+// RDS specification.
+var rdsCharset = map[rune]byte{
+	'$': 0xAB, '¤': 0x24, '―': 0x5E, '‖': 0x60, '¯': 0x7E,
+
+	'á': 0x80, 'à': 0x81, 'é': 0x82, 'è': 0x83, 'í': 0x84, 'ì': 0x85, 'ó': 0x86, 'ò': 0x87,
+	'ú': 0x88, 'ù': 0x89, 'Ñ': 0x8A, 'Ç': 0x8B, 'Ş': 0x8C, 'ß': 0x8D, '¡': 0x8E, 'Ĳ': 0x8F,
+
+	'â': 0x90, 'ä': 0x91, 'ê': 0x92, 'ë': 0x93, 'î': 0x94, 'ï': 0x95, 'ô': 0x96, 'ö': 0x97,
+	'û': 0x98, 'ü': 0x99, 'ñ': 0x9A, 'ç': 0x9B, 'ş': 0x9C, 'ğ': 0x9D, 'ı': 0x9E, 'ĳ': 0x9F,
+
+	'ª': 0xA0, 'α': 0xA1, '©': 0xA2, '‰': 0xA3, 'Ğ': 0xA4, 'ě': 0xA5, 'ň': 0xA6, 'ő': 0xA7,
+	'π': 0xA8, '€': 0xA9, '£': 0xAA, '←': 0xAC, '↑': 0xAD, '→': 0xAE, '↓': 0xAF,
+
+	'º': 0xB0, '¹': 0xB1, '²': 0xB2, '³': 0xB3, '±': 0xB4, 'İ': 0xB5, 'ń': 0xB6, 'ű': 0xB7,
+	'µ': 0xB8, '¿': 0xB9, '÷': 0xBA, '°': 0xBB, '¼': 0xBC, '½': 0xBD, '¾': 0xBE, '§': 0xBF,
+
+	'Á': 0xC0, 'À': 0xC1, 'É': 0xC2, 'È': 0xC3, 'Í': 0xC4, 'Ì': 0xC5, 'Ó': 0xC6, 'Ò': 0xC7,
+	'Ú': 0xC8, 'Ù': 0xC9, 'Ř': 0xCA, 'Č': 0xCB, 'Š': 0xCC, 'Ž': 0xCD, 'Đ': 0xCE, 'Ŀ': 0xCF,
+
+	'Â': 0xD0, 'Ä': 0xD1, 'Ê': 0xD2, 'Ë': 0xD3, 'Î': 0xD4, 'Ï': 0xD5, 'Ô': 0xD6, 'Ö': 0xD7,
+	'Û': 0xD8, 'Ü': 0xD9, 'ř': 0xDA, 'č': 0xDB, 'š': 0xDC, 'ž': 0xDD, 'đ': 0xDE, 'ŀ': 0xDF,
+
+	'Ã': 0xE0, 'Å': 0xE1, 'Æ': 0xE2, 'Œ': 0xE3, 'ŷ': 0xE4, 'Ý': 0xE5, 'Õ': 0xE6, 'Ø': 0xE7,
+	'Þ': 0xE8, 'Ŋ': 0xE9, 'Ŕ': 0xEA, 'Ć': 0xEB, 'Ś': 0xEC, 'Ź': 0xED, 'Ŧ': 0xEE, 'ð': 0xEF,
+
+	'ã': 0xF0, 'å': 0xF1, 'æ': 0xF2, 'œ': 0xF3, 'ŵ': 0xF4, 'ý': 0xF5, 'õ': 0xF6, 'ø': 0xF7,
+	'þ': 0xF8, 'ŋ': 0xF9, 'ŕ': 0xFA, 'ć': 0xFB, 'ś': 0xFC, 'ź': 0xFD, 'ŧ': 0xFE,
+}
+
+// toRDS converts the text to the RDS character repertoire, one byte per
+// character. Characters without an RDS equivalent are replaced by '?'.
+func toRDS(text string) []byte {
+	res := make([]byte, 0, len(text))
+	for _, ch := range text {
+		if b, ok := rdsCharset[ch]; ok {
+			res = append(res, b)
+			continue
+		}
+
+		switch {
+		case ch == '^' || ch == '`' || ch == '~':
+			// these codes hold other characters in RDS
+			res = append(res, '?')
+		case ch >= 0x20 && ch <= 0x7D:
+			res = append(res, byte(ch))
+		default:
+			res = append(res, '?')
+		}
+	}
+	return res
+}
+
+// Region selects between the RDS standard used in Europe
+// and the RBDS standard used in North America.
+type Region uint8
+
+//goland:noinspection GoUnusedConst,GoUnnecessarilyExportedIdentifiers
+const (
+	// RegionEurope uses the RDS standard.
+	RegionEurope Region = iota
+
+	// RegionNorthAmerica uses the RBDS standard.
+	RegionNorthAmerica
+)
+
+// rdsProgramTypes lists the RDS program type names.
+var rdsProgramTypes = [32]string{
+	"None", "News", "Current Affairs", "Information",
+	"Sport", "Education", "Drama", "Culture",
+	"Science", "Varied", "Pop Music", "Rock Music",
+	"Easy Listening", "Light Classical", "Serious Classical", "Other Music",
+	"Weather", "Finance", "Children's Programmes", "Social Affairs",
+	"Religion", "Phone-in", "Travel", "Leisure",
+	"Jazz Music", "Country Music", "National Music", "Oldies Music",
+	"Folk Music", "Documentary", "Alarm Test", "Alarm",
+}
+
+// rbdsProgramTypes lists the RBDS program type names.
+var rbdsProgramTypes = [32]string{
+	"None", "News", "Information", "Sports",
+	"Talk", "Rock", "Classic Rock", "Adult Hits",
+	"Soft Rock", "Top 40", "Country", "Oldies",
+	"Soft", "Nostalgia", "Jazz", "Classical",
+	"Rhythm and Blues", "Soft Rhythm and Blues", "Language", "Religious Music",
+	"Religious Talk", "Personality", "Public", "College",
+	"Spanish Talk", "Spanish Music", "Hip Hop", "Unassigned",
+	"Unassigned", "Weather", "Emergency Test", "Emergency",
+}
+
+// ProgramTypeName returns the name of the program type code for the region.
+func (r Region) ProgramTypeName(pty uint8) string {
+	if pty > 31 {
+		return ""
+	}
+	if r == RegionNorthAmerica {
+		return rbdsProgramTypes[pty]
+	}
+	return rdsProgramTypes[pty]
+}
+
+// PICodeFromCallSign derives the RBDS program identification code
+// from a four letter North American call sign, e.g. "KABC".
+// Call signs starting with K map to 0x1000 ... 0x54A7 and call signs
+// starting with W map to 0x54A8 ... 0x994F.
+func PICodeFromCallSign(call string) (uint16, error) {
+	call = strings.ToUpper(call)
+	if len(call) != 4 {
+		return 0, fmt.Errorf("call sign %q must have four letters", call)
+	}
+
+	var base uint16
+	switch call[0] {
+	case 'K':
+		base = 4096
+	case 'W':
+		base = 21672
+	default:
+		return 0, fmt.Errorf("call sign %q must start with K or W", call)
+	}
+
+	var code uint16
+	for _, ch := range call[1:] {
+		if ch < 'A' || ch > 'Z' {
+			return 0, fmt.Errorf("call sign %q must only contain letters", call)
+		}
+		code = code*26 + uint16(ch-'A')
+	}
+
+	return base + code, nil
+}
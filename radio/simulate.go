@@ -0,0 +1,166 @@
+package radio
+
+import (
+	"strings"
+	"sync"
+)
+
+// SimulatedState is the state of the in-memory device used with Simulate.
+type SimulatedState struct {
+	// PoweredUp tells if the device is between its Start and Halt
+	PoweredUp bool
+
+	// Frequency is the tuned frequency, in 10 kHz units
+	Frequency uint16
+
+	// Power is the transmission power, in dBuV
+	Power uint8
+
+	// Station is the first RDS station name
+	Station string
+
+	// Message is the RDS radio text
+	Message string
+}
+
+// SimulatedState returns the state of the simulated device.
+// It is empty when the driver doesn't Simulate or isn't started.
+func (s *Si4713Driver) SimulatedState() SimulatedState {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	dev, ok := s.conn.(*simulatedDevice)
+	if !ok {
+		return SimulatedState{}
+	}
+	return dev.state()
+}
+
+// simulatedDevice is an i2c connection answering the commands like
+// a Si4713 would, keeping the state they set.
+type simulatedDevice struct {
+	mtx sync.Mutex
+
+	poweredUp bool
+	frequency uint16
+	power     uint8
+	station   [rdsMaxStations * rdsStationNameLength]byte
+	message   [64]byte
+
+	// pending is the response to the last command, after the CTS status
+	// read by the command itself
+	pending []byte
+}
+
+func (d *simulatedDevice) state() SimulatedState {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return SimulatedState{
+		PoweredUp: d.poweredUp,
+		Frequency: d.frequency,
+		Power:     d.power,
+		Station:   strings.TrimRight(string(d.station[:rdsStationNameLength]), " \x00"),
+		Message:   strings.TrimRight(string(d.message[:]), " \x00"),
+	}
+}
+
+func (d *simulatedDevice) Read(b []byte) (int, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for i := range b {
+		if len(d.pending) == 0 {
+			// clear to send, with the tuning complete
+			b[i] = STATUS_CTS | 0x01
+			continue
+		}
+		b[i], d.pending = d.pending[0], d.pending[1:]
+	}
+	return len(b), nil
+}
+
+func (d *simulatedDevice) Write(b []byte) (int, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.pending = nil
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	switch {
+	case b[0] == CMD_POWER_UP:
+		d.poweredUp = true
+	case b[0] == CMD_POWER_DOWN:
+		d.poweredUp = false
+	case b[0] == CMD_GET_REV:
+		d.pending = []byte{STATUS_CTS, STATUS_CTS, 13, 0x33, 0x30, 0x00, 0x01, 0x32, 0x30, 3}
+	case b[0] == CMD_TX_TUNE_FREQ && len(b) >= 4:
+		d.frequency = uint16(b[2])<<8 | uint16(b[3])
+	case b[0] == CMD_TX_TUNE_POWER && len(b) >= 4:
+		d.power = b[3]
+	case b[0] == CMD_TX_TUNE_STATUS:
+		d.pending = []byte{STATUS_CTS, STATUS_CTS, 0, uint8(d.frequency >> 8), uint8(d.frequency), 0, d.power, 0, 0}
+	case b[0] == CMD_TX_RDS_PS && len(b) >= 6:
+		copy(d.station[int(b[1])*4:], b[2:6])
+	case b[0] == CMD_TX_RDS_BUFF && len(b) >= 8:
+		d.loadRDSGroup(b[1], b[2:8])
+	}
+	return len(b), nil
+}
+
+// loadRDSGroup keeps the radio text of the 2A groups, block B then C and D,
+// loaded in the circular buffer.
+func (d *simulatedDevice) loadRDSGroup(flags uint8, blocks []byte) {
+	if flags&rdsBuffFIFO != 0 {
+		return
+	}
+	if flags&rdsBuffEmpty != 0 {
+		d.message = [64]byte{}
+	}
+	if blocks[0]>>4 != 0x2 {
+		return
+	}
+	copy(d.message[int(blocks[1]&0x0F)*4:], blocks[2:6])
+}
+
+func (d *simulatedDevice) Close() error {
+	return nil
+}
+
+func (d *simulatedDevice) ReadByte() (byte, error) {
+	b := []byte{0}
+	_, err := d.Read(b)
+	return b[0], err
+}
+
+func (d *simulatedDevice) ReadByteData(uint8) (uint8, error) {
+	return d.ReadByte()
+}
+
+func (d *simulatedDevice) ReadWordData(uint8) (uint16, error) {
+	b := []byte{0, 0}
+	_, err := d.Read(b)
+	return uint16(b[1])<<8 | uint16(b[0]), err
+}
+
+func (d *simulatedDevice) WriteByte(val byte) error {
+	_, err := d.Write([]byte{val})
+	return err
+}
+
+func (d *simulatedDevice) WriteByteData(reg uint8, val uint8) error {
+	_, err := d.Write([]byte{reg, val})
+	return err
+}
+
+func (d *simulatedDevice) WriteWordData(reg uint8, val uint16) error {
+	_, err := d.Write([]byte{reg, uint8(val), uint8(val >> 8)})
+	return err
+}
+
+func (d *simulatedDevice) WriteBlockData(reg uint8, b []byte) error {
+	_, err := d.Write(append([]byte{reg}, b...))
+	return err
+}
@@ -0,0 +1,56 @@
+package radio
+
+import "testing"
+
+func TestSimulate(t *testing.T) {
+	cfg := Si4713Config{
+		TransmitFrequency: 9550,
+		TransmitPower:     115,
+		HasRDS:            true,
+		RDSStationName:    "DLSNIPER",
+		RDSMessage:        "DlSnIpEr in the mix",
+		Simulate:          true,
+		Log:               t.Logf,
+	}
+	s, err := NewSi4713Driver(nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.SimulatedState(); got != (SimulatedState{}) {
+		t.Errorf("got state %+v before Start, want none", got)
+	}
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	want := SimulatedState{PoweredUp: true, Frequency: 9550, Power: 115, Station: "DLSNIPER", Message: "DlSnIpEr in the mix"}
+	if got := s.SimulatedState(); got != want {
+		t.Errorf("got state %+v after Start, want %+v", got, want)
+	}
+
+	if err := s.SetTransmitFrequency(10110); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRDSMessage("Now playing"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.SimulatedState(); got.Frequency != 10110 || got.Message != "Now playing" {
+		t.Errorf("got state %+v, want 101.10 MHz and the new message", got)
+	}
+	status, err := s.GetTuneStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.FrequencyKHz != 10110 || status.PowerDBuV != 115 {
+		t.Errorf("got tune status %+v, want 101.10 MHz at 115 dBuV", status)
+	}
+
+	if err := s.Halt(); err != nil {
+		t.Fatal(err)
+	}
+	want = SimulatedState{Frequency: 10110, Power: 115, Station: "DLSNIPER"}
+	if got := s.SimulatedState(); got != want {
+		t.Errorf("got state %+v after Halt, want %+v", got, want)
+	}
+}
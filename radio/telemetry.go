@@ -0,0 +1,110 @@
+package radio
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Publisher sends a payload to a topic, e.g. with an MQTT client.
+type Publisher interface {
+	Publish(topic string, payload []byte) error
+}
+
+// TelemetryReport is the JSON payload published by Telemetry.
+type TelemetryReport struct {
+	TuneStatus   TuneStatus   `json:"tune_status"`
+	AudioQuality AudioQuality `json:"audio_quality"`
+}
+
+// Telemetry periodically publishes the TuneStatus and AudioQuality of a driver.
+type Telemetry struct {
+	driver    *Si4713Driver
+	publisher Publisher
+	topic     string
+	interval  time.Duration
+
+	mtx  sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewTelemetry creates a publisher of the driver telemetry to the topic.
+// The interval defaults to 10 seconds when 0.
+func NewTelemetry(driver *Si4713Driver, publisher Publisher, topic string, interval time.Duration) *Telemetry {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &Telemetry{
+		driver:    driver,
+		publisher: publisher,
+		topic:     topic,
+		interval:  interval,
+	}
+}
+
+// Start publishes the telemetry each interval until Stop is called.
+// The publishing errors are logged.
+func (t *Telemetry) Start() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.stop != nil {
+		return fmt.Errorf("telemetry already started")
+	}
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+
+	go t.run(t.stop, t.done)
+	return nil
+}
+
+// Stop stops publishing the telemetry and waits for the last publication to end.
+func (t *Telemetry) Stop() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.stop == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+	t.stop, t.done = nil, nil
+}
+
+func (t *Telemetry) run(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := t.Publish(); err != nil {
+				t.driver.Logger.Errorf("failed to publish the telemetry: %v\n", err)
+			}
+		}
+	}
+}
+
+// Publish reads the TuneStatus and AudioQuality then publishes them once.
+func (t *Telemetry) Publish() error {
+	var report TelemetryReport
+	var err error
+	if report.TuneStatus, err = t.driver.GetTuneStatus(); err != nil {
+		return err
+	}
+	if report.AudioQuality, err = t.driver.GetAudioQuality(); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return t.publisher.Publish(t.topic, payload)
+}
@@ -0,0 +1,96 @@
+package radio
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"fmradio/radio/radiotest"
+)
+
+type fakePublisher struct {
+	mtx      sync.Mutex
+	topics   []string
+	payloads [][]byte
+}
+
+func (p *fakePublisher) Publish(topic string, payload []byte) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.topics = append(p.topics, topic)
+	p.payloads = append(p.payloads, payload)
+	return nil
+}
+
+func (p *fakePublisher) count() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return len(p.payloads)
+}
+
+func TestTelemetryPublish(t *testing.T) {
+	adaptor := radiotest.NewAdaptor(map[byte][]byte{
+		CMD_TX_TUNE_STATUS: {STATUS_CTS, STATUS_CTS, 0, 0x25, 0x4E, 0, 100, 4, 12},
+		CMD_TX_ASQ_STATUS:  {STATUS_CTS, STATUS_CTS, asqLow, 0, 0, 0xEC},
+	})
+	s := newTestDriver(t, adaptor, Si4713Config{})
+	publisher := &fakePublisher{}
+
+	telemetry := NewTelemetry(s, publisher, "radio/station1", time.Second)
+	if err := telemetry.Publish(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(publisher.topics) != 1 || publisher.topics[0] != "radio/station1" {
+		t.Fatalf("got topics %v, want radio/station1", publisher.topics)
+	}
+
+	var got map[string]map[string]float64
+	if err := json.Unmarshal(publisher.payloads[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]float64{
+		"tune_status":   {"FrequencyKHz": 9550, "PowerDBuV": 100, "AntennaCap": 4, "NoiseLevel": 12},
+		"audio_quality": {"Status": STATUS_CTS, "Flags": asqLow, "InputLevelDBFS": -20},
+	}
+	for group, fields := range want {
+		if len(got[group]) != len(fields) {
+			t.Errorf("got %s %v, want %v", group, got[group], fields)
+		}
+		for name, value := range fields {
+			if got[group][name] != value {
+				t.Errorf("got %s.%s %v, want %v", group, name, got[group][name], value)
+			}
+		}
+	}
+}
+
+func TestTelemetryStartStop(t *testing.T) {
+	s := newTestDriver(t, radiotest.NewAdaptor(nil), Si4713Config{})
+	publisher := &fakePublisher{}
+
+	telemetry := NewTelemetry(s, publisher, "radio", time.Millisecond)
+	if err := telemetry.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := telemetry.Start(); err == nil {
+		t.Error("expected an error when starting twice")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for publisher.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	telemetry.Stop()
+
+	published := publisher.count()
+	if published < 2 {
+		t.Fatalf("got %d publications, want at least 2", published)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if publisher.count() != published {
+		t.Error("expected no publication after Stop")
+	}
+	telemetry.Stop()
+}